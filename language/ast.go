@@ -2,7 +2,10 @@ package language
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type NodeType string
@@ -23,15 +26,23 @@ const (
 	AssignmentNode NodeType = "ASSIGNMENT"
 	BlockNode      NodeType = "BLOCK"
 	CompileNode    NodeType = "COMPILE"
+	ArgvNode       NodeType = "ARGV"
+	DirNode        NodeType = "DIR"
+	EnvNode        NodeType = "ENV"
+	DotenvNode     NodeType = "DOTENV"
+	SecretNode     NodeType = "SECRET"
 
 	// Expression nodes
-	IdentNode     NodeType = "IDENT"
-	StringNode    NodeType = "STRING"
-	NumberNode    NodeType = "NUMBER"
-	BinaryOpNode  NodeType = "BINARY_OP"
-	UnaryOpNode   NodeType = "UNARY_OP"
-	ShellExprNode NodeType = "SHELL_EXPR"
-	ConcatNode    NodeType = "CONCAT"
+	IdentNode      NodeType = "IDENT"
+	StringNode     NodeType = "STRING"
+	NumberNode     NodeType = "NUMBER"
+	BinaryOpNode   NodeType = "BINARY_OP"
+	UnaryOpNode    NodeType = "UNARY_OP"
+	ShellExprNode  NodeType = "SHELL_EXPR"
+	ConcatNode     NodeType = "CONCAT"
+	ComparisonNode NodeType = "COMPARISON"
+	ListNode       NodeType = "LIST"
+	CallNode       NodeType = "CALL"
 )
 
 var lexerMap map[TokenType]string = map[TokenType]string{
@@ -84,14 +95,100 @@ type Node interface {
 	String() string
 }
 
+// RetryPolicy is the `retry <count> [backoff "<duration>"] [on <code>, ...]` attribute
+// of tasks and of `shell`/`compile` statements.
+type RetryPolicy struct {
+	Count     int           // retries after the first attempt
+	Backoff   time.Duration // wait before the first retry, doubled for every retry after it
+	ExitCodes []int         // only retry on these exit codes, any failure if empty
+}
+
+func (r *RetryPolicy) retriesOn(exitCode int) bool {
+	if len(r.ExitCodes) == 0 {
+		return true
+	}
+	return slices.Contains(r.ExitCodes, exitCode)
+}
+
+const (
+	maxRetries = 100              // more retries than this are rejected by the parser
+	maxBackoff = 10 * time.Minute // the doubled backoff doesn't grow beyond this (or the backoff itself if that's longer)
+)
+
+// backoffFor returns how long to wait after the given (1 based) failed attempt.
+func (r *RetryPolicy) backoffFor(attempt int) time.Duration {
+	limit := max(r.Backoff, maxBackoff)
+	wait := r.Backoff
+	for n := 1; n < attempt && wait < limit; n++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
+
+func (r *RetryPolicy) String() string {
+	if r == nil {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf(" retry %d", r.Count))
+	if r.Backoff > 0 {
+		out.WriteString(fmt.Sprintf(" backoff %q", r.Backoff))
+	}
+	if len(r.ExitCodes) > 0 {
+		codes := make([]string, len(r.ExitCodes))
+		for idx, code := range r.ExitCodes {
+			codes[idx] = strconv.Itoa(code)
+		}
+		out.WriteString(" on " + strings.Join(codes, ", "))
+	}
+	return out.String()
+}
+
+// CommandAttributes are the attributes that can follow a `shell` or `compile` statement on its line.
+type CommandAttributes struct {
+	Retry        *RetryPolicy
+	AllowFailure bool   // `allow_failure` or `|| ignore`, the task carries on when the command fails
+	Status       string // `as <name>` sets <name> to the exit code and <name>.signal to the signal that killed it
+}
+
+func (a CommandAttributes) String() string {
+	out := a.Retry.String()
+	if a.AllowFailure {
+		out += " allow_failure"
+	}
+	if a.Status != "" {
+		out += " as " + a.Status
+	}
+	return out
+}
+
 type CompileStatement struct {
 	File    Node
 	Command Node
+	Depfile Node // nil, or the Makefile-style dependency file the command writes
+	CommandAttributes
 }
 
 func (c *CompileStatement) Type() NodeType { return CompileNode }
 func (c *CompileStatement) String() string {
-	return fmt.Sprintf("compile %s %s", c.File.String(), c.Command.String())
+	depfile := ""
+	if c.Depfile != nil {
+		depfile = " depfile " + c.Depfile.String()
+	}
+	return fmt.Sprintf("compile %s %s%s%s", c.File.String(), c.Command.String(), depfile, c.CommandAttributes)
+}
+
+// ComparisonOperation is `left == right` or `left != right` in the condition of an if,
+// the values are compared as text so `$? == 1` works.
+type ComparisonOperation struct {
+	Left     Node
+	Operator string
+	Right    Node
+}
+
+func (c *ComparisonOperation) Type() NodeType { return ComparisonNode }
+func (c *ComparisonOperation) String() string {
+	return fmt.Sprintf("%s %s %s", c.Left.String(), c.Operator, c.Right.String())
 }
 
 type ConcatOperation struct {
@@ -119,8 +216,14 @@ func (p *Program) String() string {
 
 type TaskDef struct {
 	Name         string
-	Inputs       []string
+	Inputs       []string // glob patterns, expanded when the task runs
+	Exclude      []string // patterns of files left out of the inputs
+	Gitignore    bool     // leave files ignored by git out of the inputs
+	Outputs      []string // glob patterns of the files the task creates, stored in the cache
+	Sandbox      bool     // run the commands in a directory with only the inputs, and take only the outputs out of it
 	Dependencies []string
+	Timeout      time.Duration // 0 means no timeout
+	Retry        *RetryPolicy  // default for the commands in the task
 	Body         Node
 }
 
@@ -133,6 +236,28 @@ func (t *TaskDef) String() string {
 		out.WriteString(" requires ")
 		out.WriteString(strings.Join(t.Dependencies, ", "))
 	}
+	if len(t.Inputs) > 0 {
+		quoted := make([]string, len(t.Inputs))
+		for idx, input := range t.Inputs {
+			quoted[idx] = fmt.Sprintf("%q", input)
+		}
+		out.WriteString(" input " + strings.Join(quoted, ", "))
+	}
+	out.WriteString(globString(t.Exclude, t.Gitignore))
+	if len(t.Outputs) > 0 {
+		quoted := make([]string, len(t.Outputs))
+		for idx, output := range t.Outputs {
+			quoted[idx] = fmt.Sprintf("%q", output)
+		}
+		out.WriteString(" output " + strings.Join(quoted, ", "))
+	}
+	if t.Sandbox {
+		out.WriteString(" sandbox")
+	}
+	if t.Timeout > 0 {
+		out.WriteString(fmt.Sprintf(" timeout %q", t.Timeout))
+	}
+	out.WriteString(t.Retry.String())
 	out.WriteString(" " + t.Body.String())
 	return out.String()
 }
@@ -146,13 +271,109 @@ func (e *ExecStatement) String() string {
 	return fmt.Sprintf("exec %s", e.TaskName)
 }
 
+// ArgvStatement is `exec ["cmd", "arg", ...]`, which runs the command directly instead of through a shell,
+// so arguments with spaces or quotes in them stay one argument.
+type ArgvStatement struct {
+	Args Node // evaluates to the argv, usually a list literal
+	CommandAttributes
+}
+
+func (a *ArgvStatement) Type() NodeType { return ArgvNode }
+func (a *ArgvStatement) String() string {
+	return fmt.Sprintf("exec %s%s", a.Args.String(), a.CommandAttributes)
+}
+
+// DirStatement is `dir "path"`, the commands after it in the same scope run in that directory.
+// A relative path is relative to the directory set around it, if there is one.
+type DirStatement struct {
+	Path Node
+}
+
+func (d *DirStatement) Type() NodeType { return DirNode }
+func (d *DirStatement) String() string {
+	return fmt.Sprintf("dir %s", d.Path.String())
+}
+
+type EnvEntry struct {
+	Name  string
+	Value Node
+}
+
+// EnvStatement is `env { NAME = value ... }`, which sets environment variables for the commands
+// after it in the same scope.
+type EnvStatement struct {
+	Entries []EnvEntry
+}
+
+func (e *EnvStatement) Type() NodeType { return EnvNode }
+func (e *EnvStatement) String() string {
+	entries := make([]string, len(e.Entries))
+	for idx, entry := range e.Entries {
+		entries[idx] = fmt.Sprintf("%s = %s", entry.Name, entry.Value.String())
+	}
+	return "env { " + strings.Join(entries, ", ") + " }"
+}
+
+// DotenvStatement is `dotenv ".env", ".env.local"`, which loads the files like an `env { }` block.
+type DotenvStatement struct {
+	Files []Node
+}
+
+func (d *DotenvStatement) Type() NodeType { return DotenvNode }
+func (d *DotenvStatement) String() string {
+	files := make([]string, len(d.Files))
+	for idx, file := range d.Files {
+		files[idx] = file.String()
+	}
+	return "dotenv " + strings.Join(files, ", ")
+}
+
+// SecretStatement is `secret TOKEN, PASSWORD`, the values of these variables (or environment
+// variables) are replaced with *** in the output from then on.
+type SecretStatement struct {
+	Names []string
+}
+
+func (s *SecretStatement) Type() NodeType { return SecretNode }
+func (s *SecretStatement) String() string { return "secret " + strings.Join(s.Names, ", ") }
+
+// ListLiteral is `[a, b, ...]`. Lists inside a list are spliced in, so `["cc", flags, file]` works.
+type ListLiteral struct {
+	Elements []Node
+}
+
+func (l *ListLiteral) Type() NodeType { return ListNode }
+func (l *ListLiteral) String() string {
+	elements := make([]string, len(l.Elements))
+	for idx, elem := range l.Elements {
+		elements[idx] = elem.String()
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// CallExpression is a call of a builtin function like `quote(file)`, see builtins.go.
+type CallExpression struct {
+	Function string
+	Args     []Node
+}
+
+func (c *CallExpression) Type() NodeType { return CallNode }
+func (c *CallExpression) String() string {
+	args := make([]string, len(c.Args))
+	for idx, arg := range c.Args {
+		args[idx] = arg.String()
+	}
+	return c.Function + "(" + strings.Join(args, ", ") + ")"
+}
+
 type ShellStatement struct {
 	Command Node
+	CommandAttributes
 }
 
 func (s *ShellStatement) Type() NodeType { return ShellNode }
 func (s *ShellStatement) String() string {
-	return fmt.Sprintf("shell %s", s.Command.String())
+	return fmt.Sprintf("shell %s%s", s.Command.String(), s.CommandAttributes)
 }
 
 type PushStatement struct {
@@ -181,14 +402,42 @@ func (i *IfStatement) String() string {
 }
 
 type ForEachStatement struct {
-	Pattern string
-	VarName string
-	Body    Node
+	Parallel  bool // run the iterations at the same time, see parallel.go
+	Pattern   string
+	Exclude   []string
+	Gitignore bool
+	VarName   string
+	Output    Node // file every iteration creates, iterations whose output is up to date are skipped, see incremental.go
+	Body      Node
 }
 
 func (f *ForEachStatement) Type() NodeType { return ForEachNode }
 func (f *ForEachStatement) String() string {
-	return fmt.Sprintf("foreach %s %s", f.Pattern, f.Body.String())
+	parallel := ""
+	if f.Parallel {
+		parallel = "parallel "
+	}
+	output := ""
+	if f.Output != nil {
+		output = " output " + f.Output.String()
+	}
+	return fmt.Sprintf("foreach %s%s%s %s%s %s", parallel, f.Pattern, globString(f.Exclude, f.Gitignore), f.VarName, output, f.Body.String())
+}
+
+// globString formats the `exclude "..."` and `gitignore` attributes of inputs and foreach loops.
+func globString(exclude []string, gitignore bool) string {
+	var out strings.Builder
+	if len(exclude) > 0 {
+		quoted := make([]string, len(exclude))
+		for idx, pattern := range exclude {
+			quoted[idx] = fmt.Sprintf("%q", pattern)
+		}
+		out.WriteString(" exclude " + strings.Join(quoted, ", "))
+	}
+	if gitignore {
+		out.WriteString(" gitignore")
+	}
+	return out.String()
 }
 
 type BlockStatement struct {
@@ -207,12 +456,16 @@ func (b *BlockStatement) String() string {
 }
 
 type AssignmentStatement struct {
+	Scope string // "global", "export" or empty for a normal assignment
 	Name  string
 	Value Node // Expression.
 }
 
 func (a *AssignmentStatement) Type() NodeType { return AssignmentNode }
 func (a *AssignmentStatement) String() string {
+	if a.Scope != "" {
+		return fmt.Sprintf("%s %s = %s", a.Scope, a.Name, a.Value)
+	}
 	return fmt.Sprintf("%s = %s", a.Name, a.Value)
 }
 
@@ -0,0 +1,48 @@
+package language
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffFor(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{0, 1, 0},
+		{0, 50, 0},
+		{time.Second, 1, time.Second},
+		{time.Second, 4, 8 * time.Second},
+		{time.Second, 10, 512 * time.Second},
+		{time.Second, 11, maxBackoff},
+		{time.Second, maxRetries, maxBackoff},
+		{time.Hour, 1, time.Hour},
+		{time.Hour, 3, time.Hour},
+	}
+	for _, tt := range tests {
+		policy := &RetryPolicy{Backoff: tt.backoff}
+		if got := policy.backoffFor(tt.attempt); got != tt.want {
+			t.Errorf("backoff %s, attempt %d: got %s, want %s", tt.backoff, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryCountLimit(t *testing.T) {
+	for _, tt := range []struct {
+		script string
+		ok     bool
+	}{
+		{`task a retry 3 { shell "true" }`, true},
+		{`task a retry 100 backoff "1s" { shell "true" }`, true},
+		{`task a retry 101 { shell "true" }`, false},
+		{`task a retry 99999999999 { shell "true" }`, false},
+	} {
+		parser := NewParser(NewLexer(tt.script))
+		parser.ParseProgram()
+		if ok := len(parser.errors) == 0; ok != tt.ok {
+			t.Errorf("%s: parsed %v, want %v (errors: %v)", tt.script, ok, tt.ok, parser.errors)
+		}
+	}
+}
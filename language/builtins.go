@@ -0,0 +1,69 @@
+package language
+
+// this file contains the builtin functions that can be called in scripts, like `quote(file)`.
+
+import (
+	"fmt"
+	"strings"
+)
+
+type builtin func(args []any) (any, error)
+
+var builtins = map[string]builtin{
+	"quote": builtinQuote,
+}
+
+func (i *Interpreter) callBuiltin(name string, args []any) (any, error) {
+	fn, exists := builtins[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	result, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return result, nil
+}
+
+// builtinQuote quotes its argument for `sh`, so `shell "rm " ++ quote(file)` is safe for any file name.
+// A list is quoted element by element and joined with spaces.
+func builtinQuote(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	if list, ok := args[0].([]string); ok {
+		return shellJoin(list), nil
+	}
+	return shellQuote(fmt.Sprintf("%v", args[0])), nil
+}
+
+// shellQuote returns s as a single word for `sh`, it's left alone if it doesn't need quoting.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := func(r rune) bool {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("@%+=:,./-_", r)
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return !safe(r) }) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellJoin quotes every argument and joins them with spaces.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// toList turns the value of an element of a list literal into the strings it adds to the list.
+func toList(val any) []string {
+	if list, ok := val.([]string); ok {
+		return list
+	}
+	return []string{fmt.Sprintf("%v", val)}
+}
@@ -0,0 +1,42 @@
+package language
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "''"},
+		{"main.c", "main.c"},
+		{"src/a-b_c.o", "src/a-b_c.o"},
+		{"key=value,x:y@z%+", "key=value,x:y@z%+"},
+		{"my file.c", "'my file.c'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a;rm -rf /", "'a;rm -rf /'"},
+		{"`id`", "'`id`'"},
+		{"*.c", "'*.c'"},
+		{"line\nbreak", "'line\nbreak'"},
+		{"ünï", "'ünï'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuoteSurvivesSh(t *testing.T) {
+	args := []string{"", "plain", "two words", "it's", `"double"`, "$HOME", "`id`", "a\\b", "*", "new\nline", "'"}
+	out, err := exec.Command("sh", "-c", `for a in `+shellJoin(args)+`; do printf '%s|' "$a"; done`).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(args, "|") + "|"; string(out) != want {
+		t.Errorf("sh got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,611 @@
+package language
+
+// this file contains the local artifact cache. Tasks with outputs are stored under a key made from the task,
+// the variables it can see and the contents of its inputs, a later run with the same key restores the
+// outputs instead of running the task. Like the bazel remote cache there's an action cache (ac/<key>.json,
+// the files of a task) and a content-addressed store (cas/<sha256>, the contents of the files).
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CACHE_DIR        = ".volt-build/cache"
+	DefaultCacheSize = 2 << 30 // bytes the cache may take before old entries are pruned
+	cacheVersion     = "1"     // part of every key, changing it invalidates the whole cache
+)
+
+// cacheEntry is the action cache entry of a task, the files it produced.
+type cacheEntry struct {
+	Task    string       `json:"task"`
+	Created time.Time    `json:"created"`
+	Files   []cachedFile `json:"files"`
+}
+
+type cachedFile struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash"`
+	Mode fs.FileMode `json:"mode"`
+	Size int64       `json:"size"`
+}
+
+// localCache is the cache under .volt-build/cache. At the end of a build that stored something, entries are
+// pruned oldest first until it's at most maxSize, pruning reads the whole cache so it isn't done on every store.
+type localCache struct {
+	mu      sync.Mutex // held while storing and pruning, so files aren't removed before their entry is written
+	dir     string
+	maxSize int64
+	stored  bool // if an entry was written since the cache was last pruned
+}
+
+func newLocalCache(dir string, maxSize int64) *localCache {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &localCache{dir: dir, maxSize: maxSize}
+}
+
+func (c *localCache) entryPath(key string) string { return filepath.Join(c.dir, "ac", key+".json") }
+func (c *localCache) blobPath(hash string) string { return filepath.Join(c.dir, "cas", hash) }
+
+// get returns the entry for key if it and all of its files are in the cache.
+func (c *localCache) get(key string) (*cacheEntry, bool) {
+	data, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	for _, file := range entry.Files {
+		if _, err := os.Stat(c.blobPath(file.Hash)); err != nil {
+			return nil, false
+		}
+	}
+
+	// pruning removes the entries used longest ago first
+	now := time.Now()
+	os.Chtimes(c.entryPath(key), now, now)
+	return &entry, true
+}
+
+// restore copies the files of entry back to where the task created them.
+func (c *localCache) restore(entry *cacheEntry) error {
+	for _, file := range entry.Files {
+		if err := copyFile(c.blobPath(file.Hash), file.Path, file.Mode); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// put stores files as the entry for key.
+func (c *localCache) put(key, task string, files []string) (*cacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{Task: task, Created: time.Now()}
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(c.blobPath(hash)); err != nil {
+			if err := copyFile(path, c.blobPath(hash), 0o644); err != nil {
+				return nil, err
+			}
+		}
+		entry.Files = append(entry.Files, cachedFile{Path: path, Hash: hash, Mode: info.Mode().Perm(), Size: info.Size()})
+	}
+
+	if err := c.writeEntry(key, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// add stores an entry from somewhere else, fetch writes the content of the files the cache doesn't have yet.
+func (c *localCache) add(key string, entry *cacheEntry, fetch func(hash string, w io.Writer) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, file := range entry.Files {
+		if _, err := os.Stat(c.blobPath(file.Hash)); err == nil {
+			continue
+		}
+		err := writeAtomic(c.blobPath(file.Hash), 0o644, func(w io.Writer) error {
+			return fetch(file.Hash, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return c.writeEntry(key, entry)
+}
+
+// writeEntry writes the entry for key once its files are stored.
+func (c *localCache) writeEntry(key string, entry *cacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "\t")
+	if err != nil {
+		return err
+	}
+	c.stored = true
+	return writeFileAtomic(c.entryPath(key), data, 0o644)
+}
+
+// pruneIfStored prunes the cache down to maxSize if anything was stored in it since it was last pruned.
+func (c *localCache) pruneIfStored() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stored {
+		return nil
+	}
+	_, _, err := c.pruneLocked(c.maxSize)
+	return err
+}
+
+// cacheUsage is what's in the cache, for pruning and `volt-build cache stats`.
+type cacheUsage struct {
+	entries  map[string]*cacheEntry // by key
+	modified map[string]time.Time   // when each entry was last stored or used
+	blobs    map[string]int64       // size of every file in the content-addressed store
+	size     int64                  // size of everything, entries included
+}
+
+func (c *localCache) usage() (*cacheUsage, error) {
+	u := &cacheUsage{entries: map[string]*cacheEntry{}, modified: map[string]time.Time{}, blobs: map[string]int64{}}
+
+	dirs := []struct {
+		name  string
+		entry bool
+	}{{"ac", true}, {"cas", false}}
+	for _, dir := range dirs {
+		files, err := os.ReadDir(filepath.Join(c.dir, dir.name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(file.Name(), ".tmp") {
+				continue
+			}
+			u.size += info.Size()
+			if !dir.entry {
+				u.blobs[file.Name()] = info.Size()
+				continue
+			}
+
+			key := strings.TrimSuffix(file.Name(), ".json")
+			data, err := os.ReadFile(c.entryPath(key))
+			if err != nil {
+				continue
+			}
+			var entry cacheEntry
+			if json.Unmarshal(data, &entry) == nil {
+				u.entries[key] = &entry
+				u.modified[key] = info.ModTime()
+			}
+		}
+	}
+	return u, nil
+}
+
+// prune removes entries, the oldest first, until the cache takes at most maxSize bytes. Files no entry
+// refers to anymore are removed with them. It returns how many entries were removed and how many bytes freed.
+func (c *localCache) prune(maxSize int64) (removed int, freed int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pruneLocked(maxSize)
+}
+
+func (c *localCache) pruneLocked(maxSize int64) (removed int, freed int64, err error) {
+	c.stored = false
+	u, err := c.usage()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	refs := map[string]int{}
+	for _, entry := range u.entries {
+		for _, file := range entry.Files {
+			refs[file.Hash]++
+		}
+	}
+	removeBlob := func(hash string) {
+		if err := os.Remove(c.blobPath(hash)); err == nil {
+			freed += u.blobs[hash]
+			u.size -= u.blobs[hash]
+		}
+	}
+
+	// files of entries that were removed, or of entries that were never written because storing them failed
+	for hash := range u.blobs {
+		if refs[hash] == 0 {
+			removeBlob(hash)
+		}
+	}
+
+	keys := slices.Collect(maps.Keys(u.entries))
+	sort.Slice(keys, func(a, b int) bool { return u.modified[keys[a]].Before(u.modified[keys[b]]) })
+	for _, key := range keys {
+		if u.size <= maxSize {
+			break
+		}
+		info, err := os.Stat(c.entryPath(key))
+		if err != nil || os.Remove(c.entryPath(key)) != nil {
+			continue
+		}
+		removed++
+		freed += info.Size()
+		u.size -= info.Size()
+
+		for _, file := range u.entries[key].Files {
+			if refs[file.Hash]--; refs[file.Hash] == 0 {
+				removeBlob(file.Hash)
+			}
+		}
+	}
+	return removed, freed, nil
+}
+
+// cacheKey returns the key of the task in the cache, from everything that decides what the task does:
+// the task itself, the variables and settings it sees and the contents of its inputs.
+func (i *Interpreter) cacheKey(task *TaskDef, inputs []string) (string, error) {
+	defer i.env.pushTaskScope()() // what the body of the task will see
+	h := sha256.New()
+	fmt.Fprintf(h, "volt-build cache %s\n%s\n", cacheVersion, task)
+	if err := i.writeSettings(h); err != nil {
+		return "", err
+	}
+
+	for _, input := range slices.Sorted(slices.Values(inputs)) {
+		hash, err := hashFile(input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "input %s %s\n", input, hash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSettings writes everything in the current scope that changes what commands do to w:
+// the variables, the environment, the working directory and the shell.
+func (i *Interpreter) writeSettings(w io.Writer) error {
+	variables := i.env.visible()
+	for _, name := range slices.Sorted(maps.Keys(variables)) {
+		fmt.Fprintf(w, "var %s=%v\n", name, variables[name])
+	}
+	exports := i.env.exports()
+	for _, name := range slices.Sorted(maps.Keys(exports)) {
+		fmt.Fprintf(w, "env %s=%v\n", name, exports[name])
+	}
+	shell, err := i.shellCommand()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "dir %s\nshell %q\n", i.env.workDir(), shell)
+	return nil
+}
+
+// restoreOutputs restores the outputs of task from the local cache, or the remote one if there is one.
+// It returns where they came from, "" if neither had them.
+func (i *Interpreter) restoreOutputs(task *TaskDef, key string) string {
+	from := "cache"
+	entry, ok := i.cache.get(key)
+	if !ok && i.remoteCache != nil && i.remoteCache.usable() {
+		var err error
+		entry, err = i.remoteCache.fetch(i.ctx, key, task, i.cache)
+		switch {
+		case errors.Is(err, errNotInCache):
+		case err != nil && i.interrupted() == nil:
+			i.remoteCache.failed(i.stderr, err)
+		case err == nil:
+			ok, from = true, "remote cache"
+		}
+	}
+	if !ok {
+		return ""
+	}
+
+	err := checkEntry(task, entry)
+	if err == nil {
+		err = i.cache.restore(entry)
+	}
+	if err == nil {
+		err = checkOutputs(task)
+	}
+	if err != nil {
+		fmt.Fprintf(i.stderr, "\x1b[1;33m[WARN]\x1b[0m cache entry of task %s is unusable, running it: %v\n", task.Name, err)
+		return ""
+	}
+	return from
+}
+
+// checkEntry checks that restoring entry only writes outputs of task. Entries from a remote cache come from
+// other machines, they mustn't be able to write anywhere else.
+func checkEntry(task *TaskDef, entry *cacheEntry) error {
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	for _, file := range entry.Files {
+		switch {
+		case !validHash(file.Hash):
+			return fmt.Errorf("invalid hash %q for %s", file.Hash, file.Path)
+		case !filepath.IsLocal(file.Path) || filepath.Clean(file.Path) != file.Path || !insideRoot(root, file.Path):
+			return fmt.Errorf("%q is outside of the project", file.Path)
+		case !isOutput(task, file.Path):
+			return fmt.Errorf("%s isn't an output of task %s", file.Path, task.Name)
+		case file.Mode&^fs.ModePerm != 0:
+			return fmt.Errorf("invalid mode %s for %s", file.Mode, file.Path)
+		}
+	}
+	return nil
+}
+
+// validHash reports if hash is a sha256 in lowercase hex, like the names of the files in cas/.
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isOutput reports if path matches an output pattern of task, or is inside a directory that does.
+func isOutput(task *TaskDef, path string) bool {
+	for _, pattern := range task.Outputs {
+		for _, alternative := range expandBraces(pattern) {
+			for p := path; p != "."; p = filepath.Dir(p) {
+				if matchPath(alternative, p) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkOutputs checks that every output pattern of task matches something.
+func checkOutputs(task *TaskDef) error {
+	for _, pattern := range task.Outputs {
+		matches, err := glob(pattern, globOptions{})
+		if err != nil {
+			return fmt.Errorf("invalid output pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("output %s is missing", pattern)
+		}
+	}
+	return nil
+}
+
+// storeOutputs puts the outputs of a task that just ran into the cache. Failing to do so doesn't fail the
+// build, the task just runs again next time.
+func (i *Interpreter) storeOutputs(task *TaskDef, key string) {
+	files, err := expandOutputs(task)
+	if err == nil && len(files) == 0 {
+		err = errors.New("its outputs don't match any files")
+	}
+	var entry *cacheEntry
+	if err == nil {
+		entry, err = i.cache.put(key, task.Name, files)
+	}
+	if err != nil {
+		fmt.Fprintf(i.stderr, "\x1b[1;33m[WARN]\x1b[0m task %s wasn't cached: %v\n", task.Name, err)
+		return
+	}
+
+	if i.remoteCache != nil && !i.remoteCache.readOnly && i.remoteCache.usable() {
+		if err := i.remoteCache.upload(i.ctx, key, entry, i.cache); err != nil && i.interrupted() == nil {
+			i.remoteCache.failed(i.stderr, err)
+		}
+	}
+}
+
+// expandOutputs returns the files matched by the output patterns of task, directories with everything in them.
+func expandOutputs(task *TaskDef) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range task.Outputs {
+		matches, err := glob(pattern, globOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("invalid output pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies src to dst through a temporary file, so dst is never half written.
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeAtomic(dst, mode, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+func writeFileAtomic(path string, data []byte, mode fs.FileMode) error {
+	return writeAtomic(path, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+func writeAtomic(path string, mode fs.FileMode, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ParseSize parses sizes like 500MB or 2G for --cache-size, units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	number := strings.TrimSuffix(upper, "B")
+	exp := 0
+	if idx := strings.LastIndexAny(number, "KMGT"); idx >= 0 && idx == len(number)-1 {
+		exp = strings.IndexByte("KMGT", number[idx]) + 1
+		number = number[:idx]
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected something like 500MB or 2GB", s)
+	}
+	for ; exp > 0; exp-- {
+		n *= 1024
+	}
+	return int64(n), nil
+}
+
+func formatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	size, unit := float64(n)/1024, 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%cB", size, units[unit])
+}
+
+// PrintCacheStats shows what's in the cache and how often tasks were restored from it in recent builds.
+func PrintCacheStats(maxSize int64) error {
+	c := newLocalCache(CACHE_DIR, maxSize)
+	u, err := c.usage()
+	if err != nil {
+		return err
+	}
+
+	tasks := map[string]int{}
+	for _, entry := range u.entries {
+		tasks[entry.Task]++
+	}
+	fmt.Printf("\x1b[1mcache\x1b[0m %s\n", c.dir)
+	fmt.Printf("  entries: %d (%d tasks)\n", len(u.entries), len(tasks))
+	fmt.Printf("  files:   %d\n", len(u.blobs))
+	fmt.Printf("  size:    %s of %s\n", formatSize(u.size), formatSize(c.maxSize))
+
+	history, err := loadHistory(HISTORY_PATH)
+	if err != nil {
+		return err
+	}
+	restored, run := 0, 0
+	for _, rec := range history {
+		for _, t := range rec.Tasks {
+			switch t.Status {
+			case taskCached:
+				restored++
+			case taskRebuilt:
+				run++
+			}
+		}
+	}
+	if restored+run > 0 {
+		fmt.Printf("  hits:    %d of %d tasks that weren't up to date in the last %d builds were restored\n", restored, restored+run, len(history))
+	}
+
+	if len(tasks) > 0 {
+		fmt.Printf("\n\x1b[1mentries per task\x1b[0m\n")
+		for _, name := range slices.Sorted(maps.Keys(tasks)) {
+			fmt.Printf("  %-24s %d\n", name, tasks[name])
+		}
+	}
+	return nil
+}
+
+// PruneCache removes the entries used longest ago until the cache takes at most maxSize bytes, 0 empties it.
+func PruneCache(maxSize int64) error {
+	removed, freed, err := newLocalCache(CACHE_DIR, DefaultCacheSize).prune(maxSize)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d cache entries, freed %s\n", removed, formatSize(freed))
+	return nil
+}
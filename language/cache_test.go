@@ -0,0 +1,44 @@
+package language
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCacheIsPrunedOnceStored(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "a.out", "aaaa")
+	writeFile(t, "b.out", "bbbb")
+	cache := newLocalCache(CACHE_DIR, 1)
+
+	if err := cache.pruneIfStored(); err != nil {
+		t.Fatal(err)
+	}
+	for key, file := range map[string]string{"a": "a.out", "b": "b.out"} {
+		if _, err := cache.put(key, key, []string{file}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := cache.get(key); !ok {
+			t.Fatalf("entry %s was pruned while storing", key)
+		}
+	}
+
+	if err := cache.pruneIfStored(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := cache.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.entries) != 0 || len(u.blobs) != 0 {
+		t.Errorf("%d entries and %d files left after pruning to 1 byte", len(u.entries), len(u.blobs))
+	}
+	if cache.stored {
+		t.Error("still marked as stored after pruning")
+	}
+	if _, err := os.Stat("a.out"); err != nil {
+		t.Errorf("pruning removed an output: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package language
+
+// this file contains `volt-build clean`, which removes the declared outputs of tasks and forgets
+// that they ran, so the next build runs them again.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Clean removes the outputs of taskNames (of all tasks if there are none) and their records in .volt-build.
+// With dependents the tasks that require them go too. Nothing is removed if an output is outside the
+// directory of volt-build, and with dryRun nothing is removed at all, only printed.
+// Without task names all of the build state goes, except the cache and the build history.
+func Clean(scriptPath string, taskNames []string, dependents, dryRun bool) error {
+	content, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return err
+	}
+	program, err := parseScript(string(content))
+	if err != nil {
+		return err
+	}
+
+	var all []*TaskDef
+	tasks := map[string]*TaskDef{}
+	for _, stmt := range program.Statements {
+		if task, ok := stmt.(*TaskDef); ok {
+			all = append(all, task)
+			tasks[task.Name] = task
+		}
+	}
+
+	selected := map[string]bool{}
+	for _, name := range taskNames {
+		if _, exists := tasks[name]; !exists {
+			return fmt.Errorf("task does not exist: %s", name)
+		}
+		selected[name] = true
+	}
+	if len(taskNames) == 0 {
+		for _, task := range all {
+			selected[task.Name] = true
+		}
+	} else if dependents {
+		// until nothing changes, chains of dependents can be in any order in the script
+		for added := true; added; {
+			added = false
+			for _, task := range all {
+				if !selected[task.Name] && slices.ContainsFunc(task.Dependencies, func(dep string) bool { return selected[dep] }) {
+					selected[task.Name] = true
+					added = true
+				}
+			}
+		}
+	}
+
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	var outputs []string
+	for _, task := range all {
+		if !selected[task.Name] {
+			continue
+		}
+		for _, pattern := range task.Outputs {
+			matches, err := glob(pattern, globOptions{})
+			if err != nil {
+				return fmt.Errorf("invalid output pattern %q of task %s: %w", pattern, task.Name, err)
+			}
+			for _, match := range matches {
+				if !insideRoot(root, match) {
+					return fmt.Errorf("refusing to remove %s, output of task %s, it's outside of %s", match, task.Name, root)
+				}
+				outputs = append(outputs, match)
+			}
+		}
+	}
+	slices.Sort(outputs)
+	outputs = slices.Compact(outputs)
+
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	for _, output := range outputs {
+		if !dryRun {
+			if err := os.RemoveAll(output); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s %s\n", verb, output)
+	}
+
+	if len(taskNames) == 0 {
+		if err := cleanState(dryRun); err != nil {
+			return err
+		}
+	} else if err := forgetTasks(slices.Sorted(maps.Keys(selected)), dryRun); err != nil {
+		return err
+	}
+
+	fmt.Printf("\x1b[1;32m[INFO]\x1b[0m %s %d outputs of %d tasks\n", verb, len(outputs), len(selected))
+	return nil
+}
+
+// cleanState removes all records of earlier builds that make tasks skip.
+func cleanState(dryRun bool) error {
+	for _, path := range []string{TIMESTAMP_PATH, DEPS_PATH, ITERATIONS_PATH, LOGS_DIR} {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would remove %s\n", path)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		fmt.Printf("removed %s\n", path)
+	}
+	return nil
+}
+
+// forgetTasks removes what .volt-build knows about names: the timestamps of their inputs (and the files
+// their depfiles listed), the depfiles, the foreach iterations that ran and the logs.
+func forgetTasks(names []string, dryRun bool) error {
+	i := NewInterpreter()
+	if err := i.loadState(); err != nil {
+		return fmt.Errorf("failed to load the state of earlier builds: %w", err)
+	}
+
+	for _, name := range names {
+		for key := range i.timestamps {
+			if strings.HasPrefix(key, name+"\t") {
+				delete(i.timestamps, key)
+			}
+		}
+		i.deps.forget(name)
+		i.iterations.forget(name)
+
+		if dryRun {
+			fmt.Printf("would forget task %s\n", name)
+			continue
+		}
+		if err := os.Remove(logPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("forgot task %s\n", name)
+	}
+
+	// without an earlier build there's nothing to save
+	if _, err := os.Stat(STATE_DIR); dryRun || err != nil {
+		return nil
+	}
+	return i.saveState()
+}
+
+// projectRoot returns the directory of volt-build with symlinks resolved.
+func projectRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(cwd)
+}
+
+// insideRoot reports if path is below root (and isn't root itself). Symlinks in the directories
+// on the way are followed, a symlink at path itself is removed and not what it points to.
+// The directories don't need to exist yet, for files restored from the cache.
+func insideRoot(root, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	dir, rest := filepath.Dir(abs), filepath.Base(abs)
+	resolved, err := filepath.EvalSymlinks(dir)
+	for errors.Is(err, fs.ErrNotExist) && filepath.Dir(dir) != dir {
+		dir, rest = filepath.Dir(dir), filepath.Join(filepath.Base(dir), rest)
+		resolved, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, filepath.Join(resolved, rest))
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
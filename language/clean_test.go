@@ -0,0 +1,57 @@
+package language
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanRefusesOutputsOutsideTheProject(t *testing.T) {
+	dir := inTempDir(t)
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "keep.txt"), "keep\n")
+	if err := os.Symlink(outside, "link"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "out/inside.txt", "inside\n")
+
+	for _, output := range []string{
+		filepath.Join(outside, "keep.txt"),
+		"../" + filepath.Base(outside) + "/keep.txt",
+		"link/keep.txt",
+		".",
+		dir,
+	} {
+		writeFile(t, "build.volt", `
+task gen input "build.volt" output "out/inside.txt", "`+output+`" {
+    shell "true"
+}
+`)
+		err := Clean("build.volt", nil, false, false)
+		if err == nil || !strings.Contains(err.Error(), "refusing") {
+			t.Errorf("output %s: got %v, want a refusal", output, err)
+		}
+		for _, path := range []string{filepath.Join(outside, "keep.txt"), "out/inside.txt", "build.volt"} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("output %s: %s was removed", output, path)
+			}
+		}
+	}
+
+	// the symlink itself is inside, it's removed and not what it points to
+	writeFile(t, "build.volt", `
+task gen input "build.volt" output "out/inside.txt", "link" {
+    shell "true"
+}
+`)
+	if err := Clean("build.volt", nil, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat("link"); err == nil {
+		t.Error("link wasn't removed")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "keep.txt")); err != nil {
+		t.Error("the target of link was removed")
+	}
+}
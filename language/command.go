@@ -0,0 +1,309 @@
+package language
+
+// this file contains the code that actually starts the commands from `shell` and `compile` statements.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outputTailSize = 4096            // bytes of output kept for reporting a failed command
+	waitDelay      = 2 * time.Second // how long to wait for output after a command was killed
+	killDelay      = 2 * time.Second // how long a cancelled command gets to exit after SIGTERM
+	timeoutCode    = 124             // exit code reported for timed out commands, like timeout(1)
+)
+
+// commandSpec describes a single external command.
+type commandSpec struct {
+	kind   string   // "shell", "compile" or "exec"
+	line   string   // the command line handed to the shell
+	argv   []string // run directly instead of through the shell if set, line is only used for reporting
+	shell  []string // the shell line is handed to, `sh -c` by default
+	env    []string // nil to inherit the environment of volt-build
+	dir    string   // "" to run in the directory of volt-build
+	stdout io.Writer
+	stderr io.Writer
+	retry  *RetryPolicy // nil to use the policy of the task, if any
+}
+
+// commandError is returned when a command fails, with what is needed to report it later.
+type commandError struct {
+	command  string
+	exitCode int
+	signal   string // name of the signal that killed the command, if one did
+	output   string // the end of the command's output, only kept in keep-going mode
+	err      error
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("command `%s` failed: %v", e.command, e.err)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// exitCodeOf returns the exit code of the process behind err, or 1 if it never got one.
+// Like in shells it's 128 + the signal number for a process that was killed by a signal.
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	if sig, _ := signalOf(err); sig > 0 {
+		return 128 + sig
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	// commands run without a shell that couldn't be started get the codes sh would use
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return 127
+	case errors.Is(err, fs.ErrPermission):
+		return 126
+	}
+	return 1
+}
+
+// exitStatus returns the value for `$?` after a command returned err.
+func exitStatus(err error) int {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.exitCode
+	}
+	return exitCodeOf(err)
+}
+
+// commandStatus sets `$?` and the `as` variable of the statement after a command. The error of
+// a command that's allowed to fail is reported to w (if it isn't nil) and dropped.
+func (i *Interpreter) commandStatus(attrs CommandAttributes, w io.Writer, err error) error {
+	code := exitStatus(err)
+	signal := ""
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		signal = cmdErr.signal
+	}
+
+	i.env.lastExitCode = code
+	if attrs.Status != "" {
+		i.env.SetVariable(attrs.Status, code)
+		i.env.SetVariable(attrs.Status+".signal", signal)
+	}
+
+	if err == nil || !attrs.AllowFailure || i.interrupted() != nil {
+		return err
+	}
+	if w != nil && cmdErr != nil {
+		fmt.Fprintf(w, "\x1b[1;33m[WARN]\x1b[0m `%s` failed with exit code %d, continuing because it's allowed to fail\n", cmdErr.command, code)
+	}
+	return nil
+}
+
+// defaultShell runs the commands of `shell` and `compile` statements unless the script or --shell says otherwise.
+var defaultShell = []string{"sh", "-c"}
+
+// shellCommand returns the shell for commands in the current scope: --shell, or the innermost
+// `shell = [...]` setting of the task or the script, or defaultShell. The command line is appended to it.
+func (i *Interpreter) shellCommand() ([]string, error) {
+	if len(i.shellOverride) > 0 {
+		return i.shellOverride, nil
+	}
+
+	val, exists := i.env.GetVariable(shellSetting)
+	if !exists {
+		return defaultShell, nil
+	}
+
+	var shell []string
+	switch v := val.(type) {
+	case []string:
+		shell = v
+	case string:
+		shell = strings.Fields(v)
+	}
+	if len(shell) == 0 {
+		return nil, fmt.Errorf("shell must be a list like [\"bash\", \"-c\"], got %v", val)
+	}
+	return shell, nil
+}
+
+// tailBuffer keeps the last `size` bytes written to it.
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.size {
+		t.buf = t.buf[len(t.buf)-t.size:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// teeWriter writes to w and to tail, w can be nil when the output is suppressed.
+func teeWriter(w io.Writer, tail *tailBuffer) io.Writer {
+	if w == nil {
+		return tail
+	}
+	return io.MultiWriter(w, tail)
+}
+
+// runCommand runs the command to completion, retrying it if it has a retry policy (or the task does).
+// Every attempt is reported on its own, only the error of the last one is returned.
+func (i *Interpreter) runCommand(spec commandSpec) error {
+	spec.env = i.commandEnv()
+	spec.dir = i.env.workDir()
+	if spec.argv == nil {
+		shell, err := i.shellCommand()
+		if err != nil {
+			return err
+		}
+		spec.shell = shell
+	}
+
+	policy := spec.retry
+	if policy == nil {
+		policy = i.taskRetry
+	}
+	if policy == nil {
+		return i.runAttempt(spec, spec.line)
+	}
+
+	attempts := policy.Count + 1
+	for attempt := 1; ; attempt++ {
+		label := fmt.Sprintf("%s (attempt %d/%d)", spec.line, attempt, attempts)
+		err := i.runAttempt(spec, label)
+		if err == nil || attempt == attempts || i.interrupted() != nil {
+			return err
+		}
+
+		code := exitCodeOf(err)
+		var cmdErr *commandError
+		if errors.As(err, &cmdErr) {
+			code = cmdErr.exitCode
+		}
+		if !policy.retriesOn(code) {
+			return err
+		}
+
+		wait := policy.backoffFor(attempt)
+		if spec.stderr != nil {
+			fmt.Fprintf(spec.stderr, "\x1b[1;33m[WARN]\x1b[0m attempt %d/%d of `%s` failed with exit code %d, retrying in %s\n",
+				attempt, attempts, i.secrets.mask(spec.line), code, wait)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-i.ctx.Done():
+			return err
+		}
+	}
+}
+
+// runAttempt runs the command once, recording it in the trace if there is one.
+func (i *Interpreter) runAttempt(spec commandSpec, label string) error {
+	ctx := i.ctx
+	if i.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, i.commandTimeout, fmt.Errorf("timed out after %s", i.commandTimeout))
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if spec.argv != nil {
+		cmd = exec.CommandContext(ctx, spec.argv[0], spec.argv[1:]...)
+	} else {
+		args := append(slices.Clone(spec.shell[1:]), spec.line)
+		cmd = exec.CommandContext(ctx, spec.shell[0], args...)
+	}
+	exited := setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	cmd.Env = spec.env
+	cmd.Dir = spec.dir
+	cmd.Stdout = spec.stdout
+	cmd.Stderr = spec.stderr
+
+	// The output is only captured when it's needed for the keep-going report,
+	// otherwise commands keep writing straight to the terminal.
+	var tail *tailBuffer
+	if i.keepGoing {
+		tail = &tailBuffer{size: outputTailSize}
+		cmd.Stdout = teeWriter(spec.stdout, tail)
+		cmd.Stderr = teeWriter(spec.stderr, tail)
+	}
+
+	// With secrets the output goes through a maskWriter, without any it's left alone
+	// so commands writing to the terminal still see one.
+	var masked []*maskWriter
+	if i.secrets.active() {
+		for _, w := range []*io.Writer{&cmd.Stdout, &cmd.Stderr} {
+			if *w != nil {
+				mw := i.secrets.writer(*w)
+				masked = append(masked, mw)
+				*w = mw
+			}
+		}
+	}
+	label = i.secrets.mask(label)
+
+	span := i.tracer.begin(spec.kind, label, i.worker)
+	start := time.Now()
+	err := cmd.Run()
+	exited()
+	for _, mw := range masked {
+		mw.Flush()
+	}
+
+	if err != nil {
+		cmdErr := &commandError{command: i.secrets.mask(spec.line), exitCode: exitCodeOf(err), err: err}
+		if ctx.Err() != nil {
+			// stopped because of a timeout or an interrupt, report why instead of "signal: terminated"
+			cmdErr.err = context.Cause(ctx)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				cmdErr.exitCode = timeoutCode
+			}
+		} else {
+			_, cmdErr.signal = signalOf(err)
+		}
+		if tail != nil {
+			cmdErr.output = tail.String()
+		}
+		err = cmdErr
+	}
+
+	i.stats.addCommand(commandStat{
+		Task:     i.currentTask,
+		Kind:     spec.kind,
+		Command:  label,
+		Duration: time.Since(start),
+		Failed:   err != nil,
+	})
+
+	args := map[string]any{"task": i.currentTask}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	i.tracer.end(span, args)
+
+	return err
+}
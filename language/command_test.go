@@ -0,0 +1,183 @@
+package language
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, "not-executable", "echo hi\n")
+	run := func(name string, args ...string) error {
+		return exec.Command(name, args...).Run()
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		unixOnly bool
+	}{
+		{"success", nil, 0, false},
+		{"exit code", run("sh", "-c", "exit 3"), 3, false},
+		{"wrapped", fmt.Errorf("step: %w", run("sh", "-c", "exit 42")), 42, false},
+		{"not found", run("volt-build-no-such-command"), 127, false},
+		{"missing file", run(dir + "/missing"), 127, false},
+		{"not executable", run(dir + "/not-executable"), 126, false},
+		{"other error", errors.New("something else"), 1, false},
+		{"signal", run("sh", "-c", "kill -TERM $$"), 128 + 15, true},
+	}
+	for _, tt := range tests {
+		if tt.unixOnly && runtime.GOOS == "windows" {
+			continue
+		}
+		if got := exitCodeOf(tt.err); got != tt.want {
+			t.Errorf("%s: exitCodeOf(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExitStatusOfCommandError(t *testing.T) {
+	err := fmt.Errorf("task a: %w", &commandError{command: "false", exitCode: 5, err: errors.New("exit status 5")})
+	if got := exitStatus(err); got != 5 {
+		t.Errorf("got %d, want 5", got)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh and sleep")
+	}
+
+	tests := []struct {
+		name    string
+		timeout string // attribute of the task
+		opts    Options
+	}{
+		{"task timeout", `timeout "200ms"`, Options{}},
+		{"--timeout", "", Options{Timeout: 200 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			writeFile(t, "in.txt", "input\n")
+
+			// the background job is in the same process group, it has to be killed with the shell
+			start := time.Now()
+			err := build(t, `
+task t input "in.txt" `+tt.timeout+` {
+    shell "(sleep 1 && touch late) & sleep 5"
+}
+exec t
+`, tt.opts)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("took %s, the command wasn't stopped", elapsed)
+			}
+			if got := exitStatus(err); got != timeoutCode {
+				t.Errorf("got exit status %d (%v), want %d", got, err, timeoutCode)
+			}
+
+			time.Sleep(1500 * time.Millisecond)
+			if _, err := os.Stat("late"); err == nil {
+				t.Error("the background job of the command outlived it")
+			}
+		})
+	}
+}
+
+func TestTimedOutCommandSetsExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh and sleep")
+	}
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	err := build(t, `
+task t input "in.txt" {
+    shell "sleep 5" || ignore
+    shell "echo " ++ $? ++ " > code.txt"
+}
+exec t
+`, Options{Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTrimmed(t, "code.txt"); got != "124" {
+		t.Errorf("$? is %s after a timeout, want 124", got)
+	}
+}
+
+func TestShellSetting(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("needs bash")
+	}
+
+	// $0 is the name of the shell running the command
+	script := `
+shell = ["bash", "-c"]
+task script input "in.txt" {
+    shell "echo $0 > script.txt"
+}
+task own input "in.txt" {
+    shell = ["sh", "-c"]
+    shell "echo $0 > own.txt"
+}
+exec script
+exec own
+shell "echo $0 > after.txt"
+`
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{"from the script", Options{}, map[string]string{"script.txt": "bash", "own.txt": "sh", "after.txt": "bash"}},
+		{"--shell", Options{Shell: []string{"sh", "-c"}}, map[string]string{"script.txt": "sh", "own.txt": "sh", "after.txt": "sh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			writeFile(t, "in.txt", "input\n")
+			if err := build(t, script, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			for file, want := range tt.want {
+				if got := readTrimmed(t, file); got != want {
+					t.Errorf("%s: ran with %q, want %q", file, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerboseShowsTheShell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("needs bash")
+	}
+	inTempDir(t)
+	out, err := os.Create("verbose.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	os.Stdout = out // put back by inTempDir
+
+	interpreter, err := newInterpreterFromOptions(context.Background(), EvalVerbose, Options{Shell: []string{"bash", "-c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := NewParser(NewLexer(`shell "true"`)).ParseProgram()
+	if _, err := interpreter.EvaluateVerbosely(program.Statements[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTrimmed(t, "verbose.txt"); !strings.Contains(got, "Running command: bash -c true") {
+		t.Errorf("got %q, want the command with the shell running it", got)
+	}
+}
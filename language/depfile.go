@@ -0,0 +1,249 @@
+package language
+
+// this file reads the dependency files compilers write with -MD/-MMD (`compile ... depfile "x.d"`), like
+// ninja's `deps = gcc`. The files they list, usually headers, are inputs of the task from the next build on.
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEPS_PATH = ".volt-build/deps.json"
+
+// depStore has the dependencies found in depfiles, by task and then by the file that was compiled,
+// and their modification times when each task last ran. It's shared by all forks of an interpreter.
+type depStore struct {
+	mu     sync.Mutex
+	deps   map[string]map[string][]string
+	mtimes map[string]map[string]time.Time // by task, so a header changing rebuilds every task that uses it
+}
+
+// depsFile is what's saved in DEPS_PATH. Files from before mtimes were kept load as empty.
+type depsFile struct {
+	Deps   map[string]map[string][]string  `json:"deps"`
+	Mtimes map[string]map[string]time.Time `json:"mtimes"`
+}
+
+func newDepStore() *depStore {
+	return &depStore{deps: map[string]map[string][]string{}, mtimes: map[string]map[string]time.Time{}}
+}
+
+func loadDeps(path string) (*depStore, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newDepStore(), nil
+	}
+	if err != nil {
+		return newDepStore(), err
+	}
+	var file depsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return newDepStore(), err
+	}
+	store := newDepStore()
+	if file.Deps != nil && file.Mtimes != nil {
+		store.deps, store.mtimes = file.Deps, file.Mtimes
+	}
+	return store, nil
+}
+
+func (s *depStore) save(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(depsFile{Deps: s.deps, Mtimes: s.mtimes}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// set replaces what compiling source in task depends on.
+func (s *depStore) set(task, source string, deps []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deps[task] == nil {
+		s.deps[task] = map[string][]string{}
+	}
+	s.deps[task][source] = deps
+}
+
+// of returns everything the files compiled by task depend on, without duplicates.
+func (s *depStore) of(task string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var all []string
+	seen := map[string]bool{}
+	for _, source := range slices.Sorted(maps.Keys(s.deps[task])) {
+		for _, dep := range s.deps[task][source] {
+			if !seen[dep] {
+				seen[dep] = true
+				all = append(all, dep)
+			}
+		}
+	}
+	return all
+}
+
+// source returns what compiling source in task depended on.
+func (s *depStore) source(task, source string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deps[task][source]
+}
+
+// forget removes everything recorded for task.
+func (s *depStore) forget(task string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deps, task)
+	delete(s.mtimes, task)
+}
+
+// mtime returns the modification time dep had when task last ran.
+func (s *depStore) mtime(task, dep string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mtime, ok := s.mtimes[task][dep]
+	return mtime, ok
+}
+
+// setMtimes replaces the modification times recorded for the dependencies of task.
+func (s *depStore) setMtimes(task string, mtimes map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mtimes[task] = mtimes
+}
+
+// currentMtimes returns the modification times the dependencies of task have now, the ones that are gone are left out.
+func (s *depStore) currentMtimes(task string) map[string]time.Time {
+	mtimes := map[string]time.Time{}
+	for _, dep := range s.of(task) {
+		if info, err := os.Stat(dep); err == nil {
+			mtimes[dep] = info.ModTime().Truncate(time.Second)
+		}
+	}
+	return mtimes
+}
+
+// readDepfile reads the depfile of a compile statement whose command succeeded, if it has one.
+func (i *Interpreter) readDepfile(cmpStmt *CompileStatement, source string, evalFn func(Node) (any, error)) error {
+	if cmpStmt.Depfile == nil {
+		return nil
+	}
+	path, err := evalFn(cmpStmt.Depfile)
+	if err != nil {
+		return err
+	}
+	return i.ingestDepfile(fmt.Sprintf("%v", path), source)
+}
+
+// ingestDepfile reads the depfile written while compiling source and records its dependencies for the running task.
+// Relative paths in it are relative to the directory the compiler ran in.
+func (i *Interpreter) ingestDepfile(path, source string) error {
+	if dir := i.env.workDir(); dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read depfile: %w", err)
+	}
+	deps, err := parseDepfile(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid depfile %s: %w", path, err)
+	}
+
+	for idx, dep := range deps {
+		if dir := i.env.workDir(); dir != "" && !filepath.IsAbs(dep) {
+			dep = filepath.Join(dir, dep)
+		}
+		deps[idx] = i.outsideSandbox(dep)
+	}
+	// outside of a task there's no staleness check that could use them
+	if i.currentTask != "" {
+		i.deps.set(i.currentTask, source, deps)
+	}
+	return nil
+}
+
+// parseDepfile returns the prerequisites of all rules in a Makefile-style depfile:
+//
+//	obj/main.o: src/main.c include/config.h \
+//	  include/my\ header.h
+//	include/config.h:
+func parseDepfile(data string) ([]string, error) {
+	var deps []string
+	seen := map[string]bool{}
+
+	// a backslash at the end of a line continues the rule on the next one
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\\\n", " ")
+
+	for n, line := range strings.Split(data, "\n") {
+		words := depfileWords(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		// the targets end with the word ending in a colon, or a colon on its own
+		colon := -1
+		for idx, word := range words {
+			if word == ":" || strings.HasSuffix(word, ":") {
+				colon = idx
+				break
+			}
+		}
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: expected `target: dependencies`", n+1)
+		}
+
+		for _, dep := range words[colon+1:] {
+			if !seen[dep] {
+				seen[dep] = true
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// depfileWords splits a line of a depfile at spaces, `\ ` is a space in a name, `\#` a # and `$$` a $.
+func depfileWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	for idx := 0; idx < len(line); idx++ {
+		c := line[idx]
+		switch {
+		case c == '\\' && idx+1 < len(line) && (line[idx+1] == ' ' || line[idx+1] == '#'):
+			idx++
+			word.WriteByte(line[idx])
+		case c == '$' && idx+1 < len(line) && line[idx+1] == '$':
+			idx++
+			word.WriteByte('$')
+		case c == ' ' || c == '\t':
+			flush()
+		case c == ':' && (idx+1 == len(line) || line[idx+1] == ' ' || line[idx+1] == '\t'):
+			// `target:dep` isn't split, so paths like C:\src\main.c stay whole
+			word.WriteByte(':')
+			flush()
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return words
+}
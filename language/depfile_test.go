@@ -0,0 +1,111 @@
+package language
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseDepfile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"one rule", "main.o: main.c config.h\n", []string{"main.c", "config.h"}},
+		{"continued", "main.o: main.c \\\n  config.h \\\n  util.h\n", []string{"main.c", "config.h", "util.h"}},
+		{"crlf", "main.o: main.c \\\r\n config.h\r\n", []string{"main.c", "config.h"}},
+		{"phony rules", "main.o: main.c config.h\nconfig.h:\n", []string{"main.c", "config.h"}},
+		{"duplicates", "a.o: a.c common.h\nb.o: b.c common.h\n", []string{"a.c", "common.h", "b.c"}},
+		{"several targets", "main.o main.d: main.c\n", []string{"main.c"}},
+		{"colon on its own", "main.o : main.c\n", []string{"main.c"}},
+		{"escaped space", "main.o: my\\ header.h\n", []string{"my header.h"}},
+		{"windows path", "main.o: C:\\src\\main.c\n", []string{"C:\\src\\main.c"}},
+	}
+	for _, tt := range tests {
+		got, err := parseDepfile(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseDepfile("main.o main.c\n"); err == nil {
+		t.Error("a line without a colon was accepted")
+	}
+}
+
+func TestDepfileWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  a.o:\tb.c  ", []string{"a.o:", "b.c"}},
+		{`a\ b.h`, []string{"a b.h"}},
+		{`\#hash.h`, []string{"#hash.h"}},
+		{"cost$$.h", []string{"cost$.h"}},
+		{"a.o:b.c", []string{"a.o:b.c"}},
+		{`C:\x.c`, []string{`C:\x.c`}},
+		{`back\slash.h`, []string{`back\slash.h`}},
+	}
+	for _, tt := range tests {
+		if got := depfileWords(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSharedHeaderRebuildsEveryTask(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "a.c", "a\n")
+	writeFile(t, "b.c", "b\n")
+	writeFile(t, "shared.h", "shared\n")
+	// writes a depfile like `cc -MD` would and counts the runs
+	writeFile(t, "cc.sh", `name=$(basename "$1" .c)
+echo "$name.o: $1 shared.h" > "$name.d"
+echo run >> "$name.runs"
+`)
+	script := `
+task a input "a.c" {
+    compile "a.c" "sh cc.sh" depfile "a.d"
+}
+task b input "b.c" {
+    compile "b.c" "sh cc.sh" depfile "b.d"
+}
+exec a
+exec b
+`
+	check := func(build int, want int) {
+		t.Helper()
+		for _, task := range []string{"a", "b"} {
+			if got := runs(t, task+".runs"); got != want {
+				t.Errorf("build %d: task %s ran %d times, want %d", build, task, got, want)
+			}
+		}
+	}
+
+	if err := build(t, script, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	check(1, 1)
+
+	later := time.Now().Add(2 * time.Second)
+	if err := os.Chtimes("shared.h", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := build(t, script, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	check(2, 2)
+
+	if err := build(t, script, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	check(3, 2)
+}
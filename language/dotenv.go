@@ -0,0 +1,156 @@
+package language
+
+// this file reads .env files, for `dotenv ".env"` and --env-file. The syntax is the usual one:
+//
+//	# comment
+//	export NAME=value        # `export` is optional, so the file can be sourced by a shell too
+//	QUOTED="line\nbreak $NAME ${OTHER:-default}"
+//	LITERAL='no $expansion here'
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type dotenvVar struct {
+	name  string
+	value string
+}
+
+// loadDotenv reads a .env file into the current scope, like an `env { }` block.
+// A missing file is skipped unless required, .env files are often per developer.
+func (i *Interpreter) loadDotenv(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return nil
+		}
+		return err
+	}
+
+	vars, err := parseDotenv(string(data), func(name string) (string, bool) {
+		if val, ok := i.env.exports()[name]; ok {
+			return fmt.Sprintf("%v", val), true
+		}
+		return os.LookupEnv(name)
+	})
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+
+	for _, v := range vars {
+		i.env.setEnv(v.name, v.value)
+		i.assigned(v.name, v.value)
+	}
+	return nil
+}
+
+// parseDotenv parses the content of a .env file. `$NAME` and `${NAME}` are expanded with the variables
+// above them in the file, then with lookup. Errors start with the line number.
+func parseDotenv(data string, lookup func(name string) (string, bool)) ([]dotenvVar, error) {
+	var vars []dotenvVar
+	defined := map[string]string{}
+	expand := func(name string) (string, bool) {
+		if val, ok := defined[name]; ok {
+			return val, true
+		}
+		return lookup(name)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for n := 0; n < len(lines); n++ {
+		lineNo := n + 1
+		line := strings.TrimSpace(lines[n])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, rest, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || !validEnvName(name) {
+			return nil, fmt.Errorf("%d: expected NAME=value, got %q", lineNo, lines[n])
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		switch {
+		case strings.HasPrefix(rest, "'") || strings.HasPrefix(rest, `"`):
+			quote := rest[0]
+			// quoted values can go on over several lines
+			raw := rest[1:]
+			end := closingQuote(raw, quote)
+			for end < 0 && n+1 < len(lines) {
+				n++
+				raw += "\n" + lines[n]
+				end = closingQuote(raw, quote)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("%d: %s has no closing %c", lineNo, name, quote)
+			}
+			if trailing := strings.TrimSpace(raw[end+1:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return nil, fmt.Errorf("%d: unexpected %q after the value of %s", lineNo, trailing, name)
+			}
+
+			value = raw[:end]
+			if quote == '"' {
+				value = expandDotenv(unescapeDotenv(value), expand)
+			}
+		default:
+			// an unquoted value ends at a comment
+			if idx := strings.Index(rest, " #"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			value = expandDotenv(strings.TrimSpace(rest), expand)
+		}
+
+		defined[name] = value
+		vars = append(vars, dotenvVar{name: name, value: value})
+	}
+	return vars, nil
+}
+
+func validEnvName(name string) bool {
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuote returns the index of the quote that ends the value, skipping escaped ones in double quotes.
+func closingQuote(s string, quote byte) int {
+	for idx := 0; idx < len(s); idx++ {
+		switch {
+		case s[idx] == '\\' && quote == '"':
+			idx++
+		case s[idx] == quote:
+			return idx
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, "\x00").Replace(s)
+}
+
+// expandDotenv replaces `$NAME`, `${NAME}` and `${NAME:-default}`. Unknown variables become empty like in sh,
+// an escaped `\$` (turned into \x00 by unescapeDotenv) stays a dollar sign.
+func expandDotenv(s string, lookup func(name string) (string, bool)) string {
+	expanded := os.Expand(s, func(name string) string {
+		name, fallback, hasFallback := strings.Cut(name, ":-")
+		if val, ok := lookup(name); ok && (val != "" || !hasFallback) {
+			return val
+		}
+		return fallback
+	})
+	return strings.ReplaceAll(expanded, "\x00", "$")
+}
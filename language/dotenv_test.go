@@ -0,0 +1,90 @@
+package language
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	env := map[string]string{"FROM_ENV": "env", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		val, ok := env[name]
+		return val, ok
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want []dotenvVar
+	}{
+		{"plain", "A=1\nB=two words\n", []dotenvVar{{"A", "1"}, {"B", "two words"}}},
+		{"comments and export", "# comment\n\nexport A=1\n", []dotenvVar{{"A", "1"}}},
+		{"trailing comment", "A=1 # comment", []dotenvVar{{"A", "1"}}},
+		{"hash in value", "A=a#b", []dotenvVar{{"A", "a#b"}}},
+		{"spaces around", "  A = 1  ", []dotenvVar{{"A", "1"}}},
+		{"empty", "A=", []dotenvVar{{"A", ""}}},
+		{"crlf", "A=1\r\nB=2\r\n", []dotenvVar{{"A", "1"}, {"B", "2"}}},
+		{"double quoted", `A="x\ty\n" # comment`, []dotenvVar{{"A", "x\ty\n"}}},
+		{"single quoted", `A='$FROM_ENV \n'`, []dotenvVar{{"A", `$FROM_ENV \n`}}},
+		{"multi-line", "A=\"line1\nline2\"\nB=3", []dotenvVar{{"A", "line1\nline2"}, {"B", "3"}}},
+		{"escaped quote", `A="say \"hi\""`, []dotenvVar{{"A", `say "hi"`}}},
+		{"earlier variable", "A=1\nB=${A}2\nC=$A", []dotenvVar{{"A", "1"}, {"B", "12"}, {"C", "1"}}},
+		{"environment", "A=$FROM_ENV", []dotenvVar{{"A", "env"}}},
+		{"file wins", "FROM_ENV=file\nA=$FROM_ENV", []dotenvVar{{"FROM_ENV", "file"}, {"A", "file"}}},
+		{"unknown", "A=x${MISSING}y", []dotenvVar{{"A", "xy"}}},
+		{"default", "A=${MISSING:-def}\nB=${EMPTY:-def}\nC=${FROM_ENV:-def}", []dotenvVar{{"A", "def"}, {"B", "def"}, {"C", "env"}}},
+		{"escaped dollar", `A="\$FROM_ENV"`, []dotenvVar{{"A", "$FROM_ENV"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseDotenv(tt.data, lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for _, data := range []string{
+		"A",
+		"=1",
+		"1A=x",
+		"A-B=1",
+		"\n\nA=\"open",
+		`A='open`,
+		`A="x" junk`,
+	} {
+		if vars, err := parseDotenv(data, func(string) (string, bool) { return "", false }); err == nil {
+			t.Errorf("%q parsed as %q", data, vars)
+		}
+	}
+
+	_, err := parseDotenv("A=1\n\nB", func(string) (string, bool) { return "", false })
+	if err == nil || !strings.HasPrefix(err.Error(), "3:") {
+		t.Errorf("error doesn't start with the line number: %v", err)
+	}
+}
+
+func TestUnescapeDotenv(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`a\nb`, "a\nb"},
+		{`a\tb`, "a\tb"},
+		{`\"q\"`, `"q"`},
+		{`back\\slash`, `back\slash`},
+		{`\\n`, `\n`},
+		{`\$HOME`, "\x00HOME"},
+		{`\x`, `\x`},
+	}
+	for _, tt := range tests {
+		if got := unescapeDotenv(tt.in); got != tt.want {
+			t.Errorf("unescapeDotenv(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
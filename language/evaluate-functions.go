@@ -1,9 +1,10 @@
 package language
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -37,7 +38,12 @@ func (i *Interpreter) spawnCompile(cmpStmt *CompileStatement) (any, error) {
 			resCh <- result{nil, fmt.Errorf("compile file must evaluate to a string")}
 			return
 		}
-		absolutePath, err := filepath.Abs(fileStr)
+		// relative to where the command runs, which is the sandbox for a sandboxed task
+		absolutePath := fileStr
+		if !filepath.IsAbs(absolutePath) {
+			absolutePath = filepath.Join(i.env.workDir(), absolutePath)
+		}
+		absolutePath, err = filepath.Abs(absolutePath)
 		if err != nil {
 			fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
 		}
@@ -52,16 +58,17 @@ func (i *Interpreter) spawnCompile(cmpStmt *CompileStatement) (any, error) {
 			return
 		}
 
-		cmd := exec.Command("sh", "-c", cmdStr+" "+absolutePath)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		err = cmd.Run()
-		if err != nil {
-			i.env.lastExitCode = 1
-		} else {
-			i.env.lastExitCode = 0
+		err = i.runCommand(commandSpec{
+			kind:   "compile",
+			line:   cmdStr + " " + shellQuote(absolutePath),
+			stdout: i.stdout,
+			stderr: i.stderr,
+			retry:  cmpStmt.Retry,
+		})
+		if err == nil {
+			err = i.readDepfile(cmpStmt, fileStr, i.Evaluate)
 		}
+		err = i.commandStatus(cmpStmt.CommandAttributes, i.stderr, err)
 		i.env.progressDone++
 		resCh <- result{nil, err}
 	}()
@@ -91,25 +98,22 @@ func (i *Interpreter) evaluateCompileWithoutPrinting(cmpStmt *CompileStatement)
 		return nil, fmt.Errorf("compile command must be a string")
 	}
 
-	cmd := exec.Command("sh", "-c", cmdStr+" "+fileStr)
-	// Don't redirect stdout/stderr to suppress output
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+	// stdout/stderr only go to the log of the task, output isn't shown in silent mode
+	spec := commandSpec{kind: "compile", line: cmdStr + " " + shellQuote(fileStr), stdout: i.stdout, stderr: i.stderr, retry: cmpStmt.Retry}
 
 	// initalize a channel to fill when command is done on seperate goroutine (cuz i like speed)
 	errCh := make(chan error, 1)
 
 	// run on seperate goroutine
 	go func() {
-		errCh <- cmd.Run()
+		errCh <- i.runCommand(spec)
 	}()
 
 	err = <-errCh
-	if err != nil {
-		i.env.lastExitCode = 1
-	} else {
-		i.env.lastExitCode = 0
+	if err == nil {
+		err = i.readDepfile(cmpStmt, fileStr, i.EvaluateWithoutPrinting)
 	}
+	err = i.commandStatus(cmpStmt.CommandAttributes, nil, err)
 
 	i.env.progressDone++
 	return nil, err
@@ -136,10 +140,14 @@ func (i *Interpreter) evaluateCompileVerbose(cmpStmt *CompileStatement) (any, er
 		return nil, fmt.Errorf("compile command must be a string")
 	}
 
-	fmt.Printf("compiling: %s; with command: %s\n", cmpStmt.File, cmpStmt.Command)
-	cmd := exec.Command("sh", "-c", cmdStr+" "+fileStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	fmt.Print(i.secrets.mask(fmt.Sprintf("compiling: %s; with command: %s\n", cmpStmt.File, cmpStmt.Command)))
+	spec := commandSpec{
+		kind:   "compile",
+		line:   cmdStr + " " + shellQuote(fileStr),
+		stdout: i.stdout,
+		stderr: i.stderr,
+		retry:  cmpStmt.Retry,
+	}
 
 	// initalize a channel to fill when command is done on seperate goroutine (cuz i like speed)
 	errCh := make(chan error, 1)
@@ -147,18 +155,16 @@ func (i *Interpreter) evaluateCompileVerbose(cmpStmt *CompileStatement) (any, er
 
 	// run on seperate goroutine
 	go func() {
-		errCh <- cmd.Run()
+		errCh <- i.runCommand(spec)
 	}()
 	fmt.Printf("errCh filled on different goroutine\n")
 	err = <-errCh
 	fmt.Printf("err: %v\n", err)
-	if err != nil {
-		i.env.lastExitCode = 1
-		fmt.Printf("last exit code resulted in: %d\n", i.env.lastExitCode)
-	} else {
-		i.env.lastExitCode = 0
-		fmt.Printf("last exit code resulted in: %d\n", i.env.lastExitCode)
+	if err == nil {
+		err = i.readDepfile(cmpStmt, fileStr, i.Evaluate)
 	}
+	err = i.commandStatus(cmpStmt.CommandAttributes, i.stderr, err)
+	fmt.Printf("last exit code resulted in: %d\n", i.env.lastExitCode)
 
 	return nil, err
 }
@@ -195,6 +201,36 @@ func (i *Interpreter) evaluateConcatWithoutPrinting(concatOp *ConcatOperation) (
 	return leftStr + rightStr, nil
 }
 
+func (i *Interpreter) evaluateComparison(cmp *ComparisonOperation) (any, error) {
+	leftVal, err := i.Evaluate(cmp.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	rightVal, err := i.Evaluate(cmp.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	equal := fmt.Sprintf("%v", leftVal) == fmt.Sprintf("%v", rightVal)
+	return equal == (cmp.Operator == "=="), nil
+}
+
+func (i *Interpreter) evaluateComparisonWithoutPrinting(cmp *ComparisonOperation) (any, error) {
+	leftVal, err := i.EvaluateWithoutPrinting(cmp.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	rightVal, err := i.EvaluateWithoutPrinting(cmp.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	equal := fmt.Sprintf("%v", leftVal) == fmt.Sprintf("%v", rightVal)
+	return equal == (cmp.Operator == "=="), nil
+}
+
 func (i *Interpreter) evaluateProgram(p *Program) (any, error) {
 	var result any
 	var err error
@@ -207,8 +243,17 @@ func (i *Interpreter) evaluateProgram(p *Program) (any, error) {
 	}
 
 	for _, stmt := range p.Statements {
+		if err := i.interrupted(); err != nil {
+			return nil, err
+		}
+
 		result, err = i.Evaluate(stmt)
 		if err != nil {
+			if i.keepGoing && i.interrupted() == nil {
+				// carry on with the next statement, the failure is reported at the end
+				i.recordFailure("", err)
+				continue
+			}
 			return nil, err
 		}
 	}
@@ -228,8 +273,17 @@ func (i *Interpreter) evaluateProgramWithoutPrinting(p *Program) (any, error) {
 	}
 
 	for _, stmt := range p.Statements {
+		if err := i.interrupted(); err != nil {
+			return nil, err
+		}
+
 		result, err = i.EvaluateWithoutPrinting(stmt)
 		if err != nil {
+			if i.keepGoing && i.interrupted() == nil {
+				// carry on with the next statement, the failure is reported at the end
+				i.recordFailure("", err)
+				continue
+			}
 			return nil, err
 		}
 
@@ -254,60 +308,117 @@ func (i *Interpreter) evaluateExec(execStmt *ExecStatement) (any, error) {
 		return nil, fmt.Errorf("task %s not found", execStmt.TaskName)
 	}
 
-	// Execute dependencies first
-	for _, depName := range task.Dependencies {
-		_, exists := i.env.GetTask(depName)
-		if !exists {
-			return nil, fmt.Errorf("task %s doesn't exist", depName)
-		}
+	if i.failureOf(task.Name) != nil {
+		return nil, &failedTaskError{task: task.Name}
+	}
 
+	// Execute dependencies first
+	err := i.runDependencies(task, func(dep *TaskDef) error {
 		// Use evaluateExec for dependencies too (for proper timestamp handling)
-		depExecStmt := &ExecStatement{TaskName: depName}
-		_, err := i.evaluateExec(depExecStmt)
-		if err != nil {
-			return nil, err
-		}
+		_, err := i.evaluateExec(&ExecStatement{TaskName: dep.Name})
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Capture current timestamps for all inputs ONCE
 	currentTimestamps := make(map[string]time.Time)
 	shouldRebuild := false
 
-	for _, input := range task.Inputs {
+	inputs, err := expandInputs(task, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files found in depfiles last time (headers and such) are inputs too, one that's gone means a rebuild
+	declared := map[string]bool{}
+	for _, input := range inputs {
+		declared[input] = true
+	}
+	for _, dep := range i.deps.of(task.Name) {
+		if _, err := os.Stat(dep); err != nil {
+			shouldRebuild = true
+		} else if !declared[dep] {
+			inputs = append(inputs, dep)
+		}
+	}
+
+	depTimestamps := make(map[string]time.Time)
+	for _, input := range inputs {
 		info, err := os.Stat(input)
 		if err != nil {
 			return nil, fmt.Errorf("error: input %s has this error: %w", input, err)
 		}
 
+		// Store for later use, the ones from depfiles are kept with the other dependencies of the task
 		currentModTime := info.ModTime().Truncate(time.Second)
-		currentTimestamps[input] = currentModTime // Store for later use
-
-		savedTimestamp, exists := i.timestamps[input]
+		var savedTimestamp time.Time
+		var exists bool
+		if declared[input] {
+			currentTimestamps[input] = currentModTime
+			savedTimestamp, exists = i.timestamps[timestampKey(task.Name, input)]
+		} else {
+			depTimestamps[input] = currentModTime
+			savedTimestamp, exists = i.deps.mtime(task.Name, input)
+		}
 
-		// Rebuild if: no saved timestamp OR saved timestamp is older than current mod time
+		// Rebuild if: no saved timestamp OR saved timestamp is older than current mod time.
+		// All inputs are still looked at, their timestamps are saved after the rebuild.
 		if !exists || savedTimestamp.Before(currentModTime) {
 			shouldRebuild = true
-			break
 		}
 	}
 
 	if !shouldRebuild {
-		fmt.Printf("\x1b[1;32m[INFO]\x1b[0m skipping task %s (inputs unchanged)\n", execStmt.TaskName)
+		i.stats.addTask(task.Name, taskSkipped, 0)
+		fmt.Fprintf(i.stdout, "\x1b[1;32m[INFO]\x1b[0m skipping task %s (inputs unchanged)\n", execStmt.TaskName)
 		return nil, nil
 	}
 
+	// Tasks with outputs may have run with the same inputs before, then the outputs come from the cache
+	cacheKey := ""
+	if i.cache != nil && len(task.Outputs) > 0 {
+		cacheKey, err = i.cacheKey(task, inputs)
+		if err != nil {
+			return nil, err
+		}
+		if from := i.restoreOutputs(task, cacheKey); from != "" {
+			for input, timestamp := range currentTimestamps {
+				i.timestamps[timestampKey(task.Name, input)] = timestamp
+			}
+			i.deps.setMtimes(task.Name, depTimestamps)
+			i.stats.addTask(task.Name, taskCached, 0)
+			fmt.Fprintf(i.stdout, "\x1b[1;32m[INFO]\x1b[0m restored task %s from %s\n", execStmt.TaskName, from)
+			return nil, nil
+		}
+	}
+
 	// Execute the task
-	result, err := i.Evaluate(task.Body)
+	result, err := i.runTaskBody(task, i.Evaluate)
 	if err != nil {
 		return nil, err
 	}
 
 	// Update timestamps using the values we captured earlier
 	for input, timestamp := range currentTimestamps {
-		i.timestamps[input] = timestamp
+		i.timestamps[timestampKey(task.Name, input)] = timestamp
+	}
+	// and of the dependencies the depfiles of this run found, the ones already known from before it ran
+	found := i.deps.currentMtimes(task.Name)
+	for dep := range found {
+		if timestamp, captured := depTimestamps[dep]; captured {
+			found[dep] = timestamp
+		} else if timestamp, captured := currentTimestamps[dep]; captured {
+			found[dep] = timestamp
+		}
+	}
+	i.deps.setMtimes(task.Name, found)
+	if cacheKey != "" {
+		i.storeOutputs(task, cacheKey)
 	}
 
-	fmt.Printf("\x1b[1;32m[INFO]\x1b[0m rebuilt task %s\n", execStmt.TaskName)
+	fmt.Fprintf(i.stdout, "\x1b[1;32m[INFO]\x1b[0m rebuilt task %s\n", execStmt.TaskName)
 	return result, nil
 }
 
@@ -317,19 +428,84 @@ func (i *Interpreter) evaluateExecWithoutPrinting(execStmt *ExecStatement) (any,
 		return nil, fmt.Errorf("task %s not found", execStmt.TaskName)
 	}
 
-	for _, depName := range task.Dependencies {
-		dep, exists := i.env.GetTask(depName)
-		if !exists {
-			return nil, fmt.Errorf("task %s doesn't exist", depName)
+	if i.failureOf(task.Name) != nil {
+		return nil, &failedTaskError{task: task.Name}
+	}
+
+	err := i.runDependencies(task, func(dep *TaskDef) error {
+		_, err := i.runTaskBody(dep, i.EvaluateWithoutPrinting)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return i.runTaskBody(task, i.EvaluateWithoutPrinting)
+}
+
+// runTaskBody evaluates the body of a task with evalFn, keeping track of which task is running.
+func (i *Interpreter) runTaskBody(task *TaskDef, evalFn func(Node) (any, error)) (any, error) {
+	if err := i.interrupted(); err != nil {
+		return nil, err
+	}
+
+	prevTask, prevRetry := i.currentTask, i.taskRetry
+	i.currentTask, i.taskRetry = task.Name, task.Retry
+	popScope := i.env.pushTaskScope()
+	if task.Timeout > 0 {
+		prevCtx := i.ctx
+		ctx, cancel := context.WithTimeoutCause(prevCtx, task.Timeout, fmt.Errorf("task %s timed out after %s", task.Name, task.Timeout))
+		i.ctx = ctx
+		defer func() {
+			cancel()
+			i.ctx = prevCtx
+		}()
+	}
+	out := newTaskOutput(task.Name, i.outputMode, i.stdout, i.stderr)
+	prevStdout, prevStderr := i.stdout, i.stderr
+	i.stdout, i.stderr = out.writers()
+	span := i.tracer.begin("task", task.Name, i.worker)
+	start := time.Now()
+
+	var result any
+	var err error
+	prevSandbox := i.sandbox
+	i.sandbox, err = i.enterSandbox(task)
+	if err == nil {
+		result, err = evalFn(task.Body)
+	}
+	if i.sandbox != nil {
+		if err == nil {
+			err = i.sandbox.collect(task)
 		}
+		i.sandbox.remove()
+	}
+	i.sandbox = prevSandbox
 
-		_, err := i.EvaluateWithoutPrinting(dep.Body)
-		if err != nil {
-			return nil, err
+	i.stdout, i.stderr = prevStdout, prevStderr
+	out.close()
+
+	args := map[string]any{}
+	status := taskRebuilt
+	if err != nil {
+		args["error"] = err.Error()
+		status = taskFailed
+	}
+	i.tracer.end(span, args)
+	i.currentTask, i.taskRetry = prevTask, prevRetry
+	popScope()
+
+	if err != nil && i.keepGoing {
+		var failed *failedTaskError
+		if errors.As(err, &failed) {
+			// an `exec` in the body failed, so this task is recorded as blocked rather than failed
+			return nil, i.recordFailure(task.Name, err)
 		}
+		err = i.recordFailure(task.Name, err)
 	}
+	i.stats.addTask(task.Name, status, time.Since(start))
 
-	return i.EvaluateWithoutPrinting(task.Body)
+	return result, err
 }
 
 func (i *Interpreter) evaluateExecVerbose(execStmt *ExecStatement) (any, error) {
@@ -339,19 +515,19 @@ func (i *Interpreter) evaluateExecVerbose(execStmt *ExecStatement) (any, error)
 		return nil, fmt.Errorf("task %s not found", execStmt.TaskName)
 	}
 
-	for _, depName := range task.Dependencies {
-		dep, exists := i.env.GetTask(depName)
-		if !exists {
-			return nil, fmt.Errorf("task %s doesn't exist", depName)
-		}
+	if i.failureOf(task.Name) != nil {
+		return nil, &failedTaskError{task: task.Name}
+	}
 
-		_, err := i.Evaluate(dep.Body)
-		if err != nil {
-			return nil, err
-		}
+	err := i.runDependencies(task, func(dep *TaskDef) error {
+		_, err := i.runTaskBody(dep, i.Evaluate)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return i.Evaluate(task.Body)
+	return i.runTaskBody(task, i.Evaluate)
 }
 
 func (i *Interpreter) evaluateShell(shellStmt *ShellStatement) (any, error) {
@@ -365,11 +541,14 @@ func (i *Interpreter) evaluateShell(shellStmt *ShellStatement) (any, error) {
 		return nil, fmt.Errorf("shell command must be a string")
 	}
 
-	cmd := exec.Command("sh", "-c", cmdStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Run()
+	err = i.runCommand(commandSpec{
+		kind:   "shell",
+		line:   cmdStr,
+		stdout: i.stdout,
+		stderr: i.stderr,
+		retry:  shellStmt.Retry,
+	})
+	err = i.commandStatus(shellStmt.CommandAttributes, i.stderr, err)
 
 	i.env.progressDone++
 	return nil, err
@@ -386,19 +565,19 @@ func (i *Interpreter) evaluateShellWithoutPrinting(shellStmt *ShellStatement) (a
 		return nil, fmt.Errorf("shell command must be a string")
 	}
 
-	cmd := exec.Command("sh", "-c", cmdStr)
-	// Don't redirect stdout/stderr to suppress output
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+	// stdout/stderr only go to the log of the task, output isn't shown in silent mode
+	spec := commandSpec{kind: "shell", line: cmdStr, stdout: i.stdout, stderr: i.stderr, retry: shellStmt.Retry}
 
 	// run the command on different goroutine so its atleast a bit parallelized. (cuz its the start)
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- cmd.Run()
+		errCh <- i.runCommand(spec)
 	}()
 
+	err = i.commandStatus(shellStmt.CommandAttributes, nil, <-errCh)
+
 	i.env.progressDone++
-	return nil, <-errCh
+	return nil, err
 }
 
 func (i *Interpreter) evaluateShellVerbose(shellStmt *ShellStatement) (any, error) {
@@ -412,20 +591,234 @@ func (i *Interpreter) evaluateShellVerbose(shellStmt *ShellStatement) (any, erro
 		return nil, fmt.Errorf("shell command must be a string")
 	}
 
-	cmd := exec.Command("sh", "-c", cmdStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	spec := commandSpec{
+		kind:   "shell",
+		line:   cmdStr,
+		stdout: i.stdout,
+		stderr: i.stderr,
+		retry:  shellStmt.Retry,
+	}
 
 	// run the command on different goroutine so its atleast a bit parallelized. (cuz its the start)
+	shell, err := i.shellCommand()
+	if err != nil {
+		return nil, err
+	}
 	errCh := make(chan error, 1)
-	fmt.Printf("Running command: sh -c %s\n", shellStmt.Command)
+	fmt.Print(i.secrets.mask(fmt.Sprintf("Running command: %s %s\n", strings.Join(shell, " "), cmdStr)))
 	go func() {
-		errCh <- cmd.Run()
+		errCh <- i.runCommand(spec)
 	}()
 	fmt.Printf("error channel filled\n")
+	err = i.commandStatus(shellStmt.CommandAttributes, i.stderr, <-errCh)
+	fmt.Printf("last exit code resulted in: %d\n", i.env.lastExitCode)
 	fmt.Printf("returning\n")
 	i.env.progressDone++
-	return nil, <-errCh
+	return nil, err
+}
+
+func (i *Interpreter) evaluateArgv(argvStmt *ArgvStatement) (any, error) {
+	argsExpr, err := i.Evaluate(argvStmt.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	argv, err := argvOf(argsExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.runCommand(commandSpec{
+		kind:   "exec",
+		line:   shellJoin(argv),
+		argv:   argv,
+		stdout: i.stdout,
+		stderr: i.stderr,
+		retry:  argvStmt.Retry,
+	})
+	err = i.commandStatus(argvStmt.CommandAttributes, i.stderr, err)
+
+	i.env.progressDone++
+	return nil, err
+}
+
+func (i *Interpreter) evaluateArgvWithoutPrinting(argvStmt *ArgvStatement) (any, error) {
+	argsExpr, err := i.EvaluateWithoutPrinting(argvStmt.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	argv, err := argvOf(argsExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	// stdout/stderr only go to the log of the task, output isn't shown in silent mode
+	err = i.runCommand(commandSpec{kind: "exec", line: shellJoin(argv), argv: argv, stdout: i.stdout, stderr: i.stderr, retry: argvStmt.Retry})
+	err = i.commandStatus(argvStmt.CommandAttributes, nil, err)
+
+	i.env.progressDone++
+	return nil, err
+}
+
+func (i *Interpreter) evaluateArgvVerbose(argvStmt *ArgvStatement) (any, error) {
+	argsExpr, err := i.Evaluate(argvStmt.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	argv, err := argvOf(argsExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Print(i.secrets.mask(fmt.Sprintf("Running command without a shell: %q\n", argv)))
+	err = i.runCommand(commandSpec{
+		kind:   "exec",
+		line:   shellJoin(argv),
+		argv:   argv,
+		stdout: i.stdout,
+		stderr: i.stderr,
+		retry:  argvStmt.Retry,
+	})
+	err = i.commandStatus(argvStmt.CommandAttributes, i.stderr, err)
+	fmt.Printf("last exit code resulted in: %d\n", i.env.lastExitCode)
+
+	i.env.progressDone++
+	return nil, err
+}
+
+// argvOf checks that the value of `exec [...]` is a command with its arguments.
+func argvOf(val any) ([]string, error) {
+	argv, ok := val.([]string)
+	if !ok {
+		return nil, fmt.Errorf("exec needs a list like [\"cmd\", \"arg\"], got %T", val)
+	}
+	if len(argv) == 0 || argv[0] == "" {
+		return nil, fmt.Errorf("exec needs a command to run")
+	}
+	return argv, nil
+}
+
+func (i *Interpreter) evaluateList(list *ListLiteral) (any, error) {
+	values := []string{}
+	for _, elem := range list.Elements {
+		val, err := i.Evaluate(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, toList(val)...)
+	}
+	return values, nil
+}
+
+func (i *Interpreter) evaluateListWithoutPrinting(list *ListLiteral) (any, error) {
+	values := []string{}
+	for _, elem := range list.Elements {
+		val, err := i.EvaluateWithoutPrinting(elem)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, toList(val)...)
+	}
+	return values, nil
+}
+
+func (i *Interpreter) evaluateCall(call *CallExpression) (any, error) {
+	args := make([]any, len(call.Args))
+	for idx, arg := range call.Args {
+		val, err := i.Evaluate(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[idx] = val
+	}
+	return i.callBuiltin(call.Function, args)
+}
+
+func (i *Interpreter) evaluateCallWithoutPrinting(call *CallExpression) (any, error) {
+	args := make([]any, len(call.Args))
+	for idx, arg := range call.Args {
+		val, err := i.EvaluateWithoutPrinting(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[idx] = val
+	}
+	return i.callBuiltin(call.Function, args)
+}
+
+func (i *Interpreter) evaluateDir(dirStmt *DirStatement) (any, error) {
+	pathExpr, err := i.Evaluate(dirStmt.Path)
+	if err != nil {
+		return nil, err
+	}
+	return nil, i.env.setWorkDir(fmt.Sprintf("%v", pathExpr))
+}
+
+func (i *Interpreter) evaluateDirWithoutPrinting(dirStmt *DirStatement) (any, error) {
+	pathExpr, err := i.EvaluateWithoutPrinting(dirStmt.Path)
+	if err != nil {
+		return nil, err
+	}
+	return nil, i.env.setWorkDir(fmt.Sprintf("%v", pathExpr))
+}
+
+func (i *Interpreter) evaluateEnv(envStmt *EnvStatement) (any, error) {
+	for _, entry := range envStmt.Entries {
+		val, err := i.Evaluate(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		i.env.setEnv(entry.Name, val)
+		i.assigned(entry.Name, val)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) evaluateEnvWithoutPrinting(envStmt *EnvStatement) (any, error) {
+	for _, entry := range envStmt.Entries {
+		val, err := i.EvaluateWithoutPrinting(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		i.env.setEnv(entry.Name, val)
+		i.assigned(entry.Name, val)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) evaluateDotenv(dotenvStmt *DotenvStatement) (any, error) {
+	for _, file := range dotenvStmt.Files {
+		path, err := i.Evaluate(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.loadDotenv(fmt.Sprintf("%v", path), false); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) evaluateDotenvWithoutPrinting(dotenvStmt *DotenvStatement) (any, error) {
+	for _, file := range dotenvStmt.Files {
+		path, err := i.EvaluateWithoutPrinting(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.loadDotenv(fmt.Sprintf("%v", path), false); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) evaluateSecret(secretStmt *SecretStatement) (any, error) {
+	for _, name := range secretStmt.Names {
+		i.markSecret(name)
+	}
+	return nil, nil
 }
 
 func (i *Interpreter) evaluatePush(pushStmt *PushStatement) (any, error) {
@@ -433,7 +826,7 @@ func (i *Interpreter) evaluatePush(pushStmt *PushStatement) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(val) // Move print here
+	fmt.Fprintln(i.stdout, i.secrets.mask(fmt.Sprintf("%v", val)))
 	return val, nil
 }
 
@@ -492,25 +885,44 @@ func (i *Interpreter) evaluateForEach(forEachStmt *ForEachStatement) (any, error
 	if strings.HasPrefix(pattern, "\"") && strings.HasSuffix(pattern, "\"") {
 		pattern = pattern[1 : len(pattern)-1]
 	}
-	matches, err := filepath.Glob(pattern)
+	matches, err := glob(pattern, globOptions{exclude: forEachStmt.Exclude, gitignore: forEachStmt.Gitignore})
+	if err != nil {
+		return nil, err
+	}
+	matches, done, err := i.pendingIterations(forEachStmt, pattern, matches, true)
 	if err != nil {
 		return nil, err
 	}
+	if forEachStmt.Parallel {
+		return i.evaluateForEachParallel(forEachStmt, matches, done, (*Interpreter).Evaluate)
+	}
 	var result any
 
-	oldValue, exists := i.env.GetVariable(forEachStmt.VarName)
+	var errs []error
 	for _, match := range matches {
-		i.env.SetVariable(forEachStmt.VarName, match)
+		if err := i.interrupted(); err != nil {
+			return nil, err
+		}
 
+		popScope := i.env.pushScope()
+		i.env.DefineVariable(forEachStmt.VarName, match)
 		result, err = i.Evaluate(forEachStmt.Body)
-		if err != nil {
-			if exists {
-				i.env.SetVariable(forEachStmt.VarName, oldValue)
-			} else {
-				delete(i.env.variables, forEachStmt.VarName)
+		popScope()
+
+		if err == nil {
+			done(match)
+		} else {
+			err = fmt.Errorf("%s: %w", match, err)
+			if !i.keepGoing || i.interrupted() != nil {
+				return nil, err
 			}
+			// in keep-going mode the other files still get their turn, the loop fails at the end
+			errs = append(errs, err)
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	return result, nil
 }
@@ -531,25 +943,44 @@ func (i *Interpreter) evaluateForEachWithoutPrinting(forEachStmt *ForEachStateme
 	if strings.HasPrefix(pattern, "\"") && strings.HasSuffix(pattern, "\"") {
 		pattern = pattern[1 : len(pattern)-1]
 	}
-	matches, err := filepath.Glob(pattern)
+	matches, err := glob(pattern, globOptions{exclude: forEachStmt.Exclude, gitignore: forEachStmt.Gitignore})
+	if err != nil {
+		return nil, err
+	}
+	matches, done, err := i.pendingIterations(forEachStmt, pattern, matches, false)
 	if err != nil {
 		return nil, err
 	}
+	if forEachStmt.Parallel {
+		return i.evaluateForEachParallel(forEachStmt, matches, done, (*Interpreter).EvaluateWithoutPrinting)
+	}
 	var result any
 
-	oldValue, exists := i.env.GetVariable(forEachStmt.VarName)
+	var errs []error
 	for _, match := range matches {
-		i.env.SetVariable(forEachStmt.VarName, match)
+		if err := i.interrupted(); err != nil {
+			return nil, err
+		}
 
+		popScope := i.env.pushScope()
+		i.env.DefineVariable(forEachStmt.VarName, match)
 		result, err = i.EvaluateWithoutPrinting(forEachStmt.Body)
-		if err != nil {
-			if exists {
-				i.env.SetVariable(forEachStmt.VarName, oldValue)
-			} else {
-				delete(i.env.variables, forEachStmt.VarName)
+		popScope()
+
+		if err == nil {
+			done(match)
+		} else {
+			err = fmt.Errorf("%s: %w", match, err)
+			if !i.keepGoing || i.interrupted() != nil {
+				return nil, err
 			}
+			// in keep-going mode the other files still get their turn, the loop fails at the end
+			errs = append(errs, err)
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	return result, nil
 }
@@ -572,27 +1003,46 @@ func (i *Interpreter) evaluateForEachVerbose(forEachStmt *ForEachStatement) (any
 	if strings.HasPrefix(pattern, "\"") && strings.HasSuffix(pattern, "\"") {
 		pattern = pattern[1 : len(pattern)-1]
 	}
-	matches, err := filepath.Glob(pattern)
+	matches, err := glob(pattern, globOptions{exclude: forEachStmt.Exclude, gitignore: forEachStmt.Gitignore})
+	if err != nil {
+		return nil, err
+	}
+	matches, done, err := i.pendingIterations(forEachStmt, pattern, matches, true)
 	if err != nil {
 		return nil, err
 	}
+	if forEachStmt.Parallel {
+		fmt.Printf("running %d iterations on up to %d workers\n", len(matches), i.jobs)
+		return i.evaluateForEachParallel(forEachStmt, matches, done, (*Interpreter).Evaluate)
+	}
 	var result any
 
-	oldValue, exists := i.env.GetVariable(forEachStmt.VarName)
+	var errs []error
 	for _, match := range matches {
-		i.env.SetVariable(forEachStmt.VarName, match)
+		if err := i.interrupted(); err != nil {
+			return nil, err
+		}
 
+		popScope := i.env.pushScope()
+		fmt.Printf("setting loop variable: %s, to value %s\n", forEachStmt.VarName, match)
+		i.env.DefineVariable(forEachStmt.VarName, match)
 		result, err = i.Evaluate(forEachStmt.Body)
-		if err != nil {
-			if exists {
-				fmt.Printf("setting variable: %s, to value %T", forEachStmt.VarName, oldValue)
-				i.env.SetVariable(forEachStmt.VarName, oldValue)
-			} else {
-				fmt.Printf("deleting variable: %s\n", forEachStmt.VarName)
-				delete(i.env.variables, forEachStmt.VarName)
+		popScope()
+
+		if err == nil {
+			done(match)
+		} else {
+			err = fmt.Errorf("%s: %w", match, err)
+			if !i.keepGoing || i.interrupted() != nil {
+				return nil, err
 			}
+			// in keep-going mode the other files still get their turn, the loop fails at the end
+			errs = append(errs, err)
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	fmt.Printf("returning\n")
 	return result, nil
@@ -602,6 +1052,8 @@ func (i *Interpreter) evaluateBlock(blockStmt *BlockStatement) (any, error) {
 	var result any
 	var err error
 
+	defer i.env.pushScope()()
+
 	for _, stmt := range blockStmt.Statements {
 		result, err = i.Evaluate(stmt)
 		if err != nil {
@@ -616,6 +1068,8 @@ func (i *Interpreter) evaluateBlockWithoutPrinting(blockStmt *BlockStatement) (a
 	var result any
 	var err error
 
+	defer i.env.pushScope()()
+
 	for _, stmt := range blockStmt.Statements {
 		result, err = i.EvaluateWithoutPrinting(stmt)
 		if err != nil {
@@ -630,6 +1084,8 @@ func (i *Interpreter) evaluateBlockVerbose(blockStmt *BlockStatement) (any, erro
 	var result any
 	var err error
 
+	defer i.env.pushScope()()
+
 	for _, stmt := range blockStmt.Statements {
 		result, err = i.Evaluate(stmt)
 		if err != nil {
@@ -672,6 +1128,10 @@ func (i *Interpreter) evaluateShellExpr(shellExpr *ShellExpr) (any, error) {
 		return i.env.lastExitCode, nil
 	}
 
+	if val, ok := i.env.exports()[shellExpr.Name]; ok {
+		return val, nil
+	}
+
 	// Fallback to actual OS environment
 	if val, ok := os.LookupEnv(shellExpr.Name); ok {
 		return val, nil
@@ -685,6 +1145,10 @@ func (i *Interpreter) evaluateShellExprWithoutPrinting(shellExpr *ShellExpr) (an
 		return i.env.lastExitCode, nil
 	}
 
+	if val, ok := i.env.exports()[shellExpr.Name]; ok {
+		return val, nil
+	}
+
 	// Fallback to actual OS environment
 	if val, ok := os.LookupEnv(shellExpr.Name); ok {
 		return val, nil
@@ -699,6 +1163,10 @@ func (i *Interpreter) evaluateShellExprVerbose(shellExpr *ShellExpr) (any, error
 		return i.env.lastExitCode, nil
 	}
 
+	if val, ok := i.env.exports()[shellExpr.Name]; ok {
+		return val, nil
+	}
+
 	// Fallback to actual OS environment
 	if val, ok := os.LookupEnv(shellExpr.Name); ok {
 		return val, nil
@@ -756,6 +1224,24 @@ func (i *Interpreter) EvaluateWithoutPrinting(node Node) (any, error) {
 		return i.evaluateShellExprWithoutPrinting(node.(*ShellExpr))
 	case ConcatNode:
 		return i.evaluateConcatWithoutPrinting(node.(*ConcatOperation))
+	case ComparisonNode:
+		return i.evaluateComparisonWithoutPrinting(node.(*ComparisonOperation))
+	case ListNode:
+		return i.evaluateListWithoutPrinting(node.(*ListLiteral))
+	case CallNode:
+		return i.evaluateCallWithoutPrinting(node.(*CallExpression))
+	case ArgvNode:
+		return i.evaluateArgvWithoutPrinting(node.(*ArgvStatement))
+	case DirNode:
+		return i.evaluateDirWithoutPrinting(node.(*DirStatement))
+	case EnvNode:
+		return i.evaluateEnvWithoutPrinting(node.(*EnvStatement))
+	case DotenvNode:
+		return i.evaluateDotenvWithoutPrinting(node.(*DotenvStatement))
+	case SecretNode:
+		return i.evaluateSecret(node.(*SecretStatement))
+	case AssignmentNode:
+		return i.evaluateAssignWithoutPrinting(node.(*AssignmentStatement))
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", node.Type())
 	}
@@ -792,6 +1278,24 @@ func (i *Interpreter) EvaluateVerbosely(node Node) (any, error) {
 		return i.evaluateShellExprVerbose(node.(*ShellExpr))
 	case ConcatNode:
 		return i.evaluateConcat(node.(*ConcatOperation))
+	case ComparisonNode:
+		return i.evaluateComparison(node.(*ComparisonOperation))
+	case ListNode:
+		return i.evaluateList(node.(*ListLiteral))
+	case CallNode:
+		return i.evaluateCall(node.(*CallExpression))
+	case ArgvNode:
+		return i.evaluateArgvVerbose(node.(*ArgvStatement))
+	case DirNode:
+		return i.evaluateDir(node.(*DirStatement))
+	case EnvNode:
+		return i.evaluateEnv(node.(*EnvStatement))
+	case DotenvNode:
+		return i.evaluateDotenv(node.(*DotenvStatement))
+	case SecretNode:
+		return i.evaluateSecret(node.(*SecretStatement))
+	case AssignmentNode:
+		return i.evaluateAssign(node.(*AssignmentStatement))
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", node.Type())
 	}
@@ -0,0 +1,334 @@
+package language
+
+// this file contains the globbing used for task inputs and foreach loops, on top of filepath.Glob it supports
+// `**` for any number of directories, braces like `*.{c,h}`, exclude patterns and .gitignore files.
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type globOptions struct {
+	exclude   []string // files matching any of these are left out
+	gitignore bool     // leave out files ignored by .gitignore files
+}
+
+// glob returns the sorted files matching pattern, minus everything excluded by opts.
+func glob(pattern string, opts globOptions) ([]string, error) {
+	seen := map[string]bool{}
+	var matches []string
+
+	for _, expanded := range expandBraces(pattern) {
+		var found []string
+		var err error
+		if strings.Contains(expanded, "**") {
+			found, err = globRecursive(expanded)
+		} else {
+			found, err = filepath.Glob(expanded)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range found {
+			if !seen[match] {
+				seen[match] = true
+				matches = append(matches, match)
+			}
+		}
+	}
+
+	var ignore *gitignore
+	if opts.gitignore {
+		ignore = newGitignore()
+	}
+
+	kept := matches[:0]
+	for _, match := range matches {
+		if excluded(match, opts.exclude) || ignore.ignored(match) {
+			continue
+		}
+		kept = append(kept, match)
+	}
+
+	sort.Strings(kept)
+	return kept, nil
+}
+
+// validatePattern reports syntax errors in a pattern without touching the filesystem.
+func validatePattern(pattern string) error {
+	for _, expanded := range expandBraces(pattern) {
+		for _, segment := range strings.Split(filepath.ToSlash(expanded), "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func excluded(file string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, expanded := range expandBraces(pattern) {
+			if matchPath(expanded, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandBraces turns `src/*.{c,h}` into `src/*.c` and `src/*.h`, braces can be nested.
+func expandBraces(pattern string) []string {
+	depth, start := 0, -1
+	for idx := 0; idx < len(pattern); idx++ {
+		switch pattern[idx] {
+		case '\\':
+			idx++ // escaped character
+		case '{':
+			if depth == 0 {
+				start = idx
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			alternatives := splitAlternatives(pattern[start+1 : idx])
+			if len(alternatives) < 2 {
+				start = -1 // `{a}` isn't a list, leave it as it is
+				continue
+			}
+
+			var expanded []string
+			for _, alt := range alternatives {
+				expanded = append(expanded, expandBraces(pattern[:start]+alt+pattern[idx+1:])...)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// splitAlternatives splits the inside of a brace on the commas that aren't in nested braces.
+func splitAlternatives(s string) []string {
+	var alternatives []string
+	depth, last := 0, 0
+	for idx := 0; idx < len(s); idx++ {
+		switch s[idx] {
+		case '\\':
+			idx++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, s[last:idx])
+				last = idx + 1
+			}
+		}
+	}
+	return append(alternatives, s[last:])
+}
+
+// matchPath matches a whole path against a pattern where `**` matches any number of directories.
+func matchPath(pattern, name string) bool {
+	return matchSegments(
+		strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/"),
+		strings.Split(filepath.ToSlash(filepath.Clean(name)), "/"),
+	)
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for skip := 0; skip <= len(name); skip++ {
+				if matchSegments(pattern, name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// globBase returns the directory everything matching pattern (without braces) is in: the part before the
+// first segment with a wildcard, or the directory of the file if there is none. deep reports if files in
+// subdirectories of it can match too.
+func globBase(pattern string) (base string, deep bool) {
+	pattern = filepath.Clean(pattern)
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	n := 0
+	for n < len(segments)-1 && !strings.ContainsAny(segments[n], `*?[\`) {
+		n++
+	}
+	base = strings.Join(segments[:n], "/")
+	switch {
+	case base == "" && strings.HasPrefix(pattern, "/"):
+		base = "/"
+	case base == "":
+		base = "."
+	}
+	return filepath.FromSlash(base), n < len(segments)-1
+}
+
+// globRecursive walks the part of the pattern before the first wildcard and matches everything under it.
+func globRecursive(pattern string) ([]string, error) {
+	pattern = filepath.Clean(pattern)
+	if err := validatePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	root, _ := globBase(pattern)
+	var matches []string
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" && file != root {
+			return filepath.SkipDir
+		}
+		if file != root && matchPath(pattern, file) {
+			matches = append(matches, file)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+type gitignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // contains a slash, so it matches relative to its .gitignore instead of any name
+}
+
+// gitignore reads .gitignore files lazily, for every directory that a checked file is in.
+type gitignore struct {
+	rules map[string][]gitignoreRule // by directory
+}
+
+func newGitignore() *gitignore {
+	return &gitignore{rules: map[string][]gitignoreRule{}}
+}
+
+func (g *gitignore) rulesFor(dir string) []gitignoreRule {
+	if rules, ok := g.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []gitignoreRule
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, " \r")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			rule := gitignoreRule{}
+			if strings.HasPrefix(line, "!") {
+				rule.negate = true
+				line = line[1:]
+			}
+			line = strings.TrimPrefix(line, `\`)
+			if strings.HasSuffix(line, "/") {
+				rule.dirOnly = true
+				line = strings.TrimSuffix(line, "/")
+			}
+			if strings.Contains(line, "/") {
+				rule.anchored = true
+				line = strings.TrimPrefix(line, "/")
+			}
+			rule.pattern = line
+			rules = append(rules, rule)
+		}
+	}
+
+	g.rules[dir] = rules
+	return rules
+}
+
+// ignored checks the file and every directory it's in, a file in an ignored directory is ignored too.
+// Only files inside the project (the current directory) can be ignored.
+func (g *gitignore) ignored(file string) bool {
+	if g == nil {
+		return false
+	}
+	file = filepath.ToSlash(filepath.Clean(file))
+	if filepath.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+		return false
+	}
+
+	parts := strings.Split(file, "/")
+	for n := 1; n <= len(parts); n++ {
+		isDir := n < len(parts)
+		if !isDir {
+			if info, err := os.Stat(file); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if g.matches(parts[:n], isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches applies the rules of every .gitignore above the path, the last matching rule wins.
+func (g *gitignore) matches(parts []string, isDir bool) bool {
+	ignored := false
+	for depth := 0; depth < len(parts); depth++ {
+		dir := "."
+		if depth > 0 {
+			dir = strings.Join(parts[:depth], "/")
+		}
+		rel := strings.Join(parts[depth:], "/")
+
+		for _, rule := range g.rulesFor(dir) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+
+			var ok bool
+			if rule.anchored {
+				ok = matchPath(rule.pattern, rel)
+			} else {
+				ok, _ = path.Match(rule.pattern, parts[len(parts)-1])
+			}
+			if ok {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
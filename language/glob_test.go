@@ -0,0 +1,107 @@
+package language
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"src/*.c", []string{"src/*.c"}},
+		{"*.{c,h}", []string{"*.c", "*.h"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"{a,b{1,2}}.txt", []string{"a.txt", "b1.txt", "b2.txt"}},
+		{"x{,y}", []string{"x", "xy"}},
+		{"{a}", []string{"{a}"}},
+		{"{a}{b,c}", []string{"{a}b", "{a}c"}},
+		{`\{a,b}`, []string{`\{a,b}`}},
+		{`{a\,b,c}`, []string{`a\,b`, "c"}},
+		{"{a,b", []string{"{a,b"}},
+		{"a,b}", []string{"a,b}"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/main.go", true},
+		{"**/*.go", "a/b/main.c", false},
+		{"src/**", "src/a/b.c", true},
+		{"src/**", "src", true},
+		{"src/**", "other/a.c", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"a/**/**/b", "a/x/b", true},
+		{"src/*.c", "src/a/b.c", false},
+		{"./src/*.c", "src/a.c", true},
+		{"src/?.c", "src/ab.c", false},
+		{"src/[ab].c", "src/b.c", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, ".gitignore", "# comment\n*.log\nbuild/\n!keep.log\n/root-only.txt\ndocs/*.tmp\n")
+	writeFile(t, "sub/.gitignore", "local.txt\n")
+	for _, file := range []string{
+		"a.log", "keep.log", "sub/a.log", "build/out.o", "sub/build/out.o", "other/build",
+		"root-only.txt", "sub/root-only.txt", "docs/x.tmp", "docs/deep/x.tmp",
+		"local.txt", "sub/local.txt", "sub/deeper/local.txt", "main.go",
+	} {
+		writeFile(t, file, "")
+	}
+
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"a.log", true},
+		{"keep.log", false},
+		{"sub/a.log", true},
+		{"build/out.o", true},
+		{"sub/build/out.o", true},
+		{"other/build", false}, // a file, `build/` only matches directories
+		{"root-only.txt", true},
+		{"sub/root-only.txt", false},
+		{"docs/x.tmp", true},
+		{"docs/deep/x.tmp", false},
+		{"local.txt", false},
+		{"sub/local.txt", true},
+		{"sub/deeper/local.txt", true},
+		{"./main.go", false},
+		{"../a.log", false},
+	}
+	ignore := newGitignore()
+	for _, tt := range tests {
+		if got := ignore.ignored(tt.file); got != tt.want {
+			t.Errorf("ignored(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+
+	got, err := glob("**/*.{log,go}", globOptions{gitignore: true, exclude: []string{"*.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"keep.log"}; !slices.Equal(got, want) {
+		t.Errorf("glob got %q, want %q", got, want)
+	}
+}
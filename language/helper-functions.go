@@ -1,12 +1,18 @@
 package language
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 )
 
+const STATE_DIR = ".volt-build" // where the state of builds is kept, relative to the directory of volt-build
+
 type EvalMode int
 
 // there's a lot of enums in this project
@@ -18,6 +24,25 @@ const (
 	EvalRegular
 )
 
+// Options holds the settings for a run that come from the command line.
+type Options struct {
+	TracePath string        // write a Chrome trace of the build here, if set
+	KeepGoing bool          // don't stop at the first failing task
+	Timeout   time.Duration // limit for every command, 0 means none
+	Jobs      int           // iterations of a parallel foreach that run at once, 0 for one per CPU
+	Shell     []string      // shell for all commands, like ["bash", "-c"], overriding the script
+	EnvFiles  []string      // .env files loaded before the script, as if they were in the environment
+	Output    OutputMode    // how the output of tasks is shown, they're logged to .volt-build/logs either way
+	NoCache   bool          // always run tasks with outputs instead of restoring them from the cache
+	CacheSize int64         // bytes the cache may take, 0 for DefaultCacheSize
+	Sandbox   bool          // run every task in a sandbox with only its inputs, as if they were all marked with `sandbox`
+
+	// RemoteCache is the url of an HTTP cache with bazel-remote's layout, shared with other machines.
+	// With RemoteCacheReadOnly set nothing is uploaded to it.
+	RemoteCache         string
+	RemoteCacheReadOnly bool
+}
+
 func Exists(filepath string) bool {
 	_, err := os.Stat(filepath)
 	if err != nil {
@@ -30,112 +55,50 @@ func Exists(filepath string) bool {
 	return true
 }
 
-func RunTaskScript(input string, mode EvalMode) error {
-	err := os.MkdirAll("./.volt-build/", 0o755)
-	if err != nil {
+// RunTaskScript runs a whole build script, ctx being cancelled (e.g. on Ctrl-C) stops the running commands.
+func RunTaskScript(ctx context.Context, input string, mode EvalMode, opts Options) error {
+	if err := createStateDir(); err != nil {
 		return err
 	}
-
-	gitignoreFile, err := os.Create("./.volt-build/.gitignore")
+	program, err := parseScript(input)
 	if err != nil {
-		fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
 		return err
 	}
-	_, err = gitignoreFile.WriteString("*")
-	if err != nil {
-		fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
-		return err
-	}
-
-	gitignoreFile.Close()
-
-	lex := NewLexer(input)
-	parser := NewParser(lex)
-	program := parser.ParseProgram()
 
-	if len(parser.errors) > 0 {
-		for _, err := range parser.errors {
-			log.Printf("%v\n", err)
-		}
-		return errors.New("parsing failed")
-	}
-
-	interpreter := NewInterpreter()
-	timestamps, err := interpreter.loadTimestamps(TIMESTAMP_PATH)
+	interpreter, err := newInterpreterFromOptions(ctx, mode, opts)
 	if err != nil {
-		fmt.Printf("Failed to load timestamps for incremental rebuilds: %v\n", err)
+		return err
 	}
-	interpreter.timestamps = timestamps
+	defer interpreter.startTrace(opts.TracePath)()
 
 	switch mode {
 	case EvalRegular:
 		_, err = interpreter.Evaluate(program)
-		if err != nil {
-			fmt.Printf("evaluation failed: %v\n", err)
-			return err
-		}
 	case EvalVerbose:
 		_, err = interpreter.EvaluateVerbosely(program)
-		if err != nil {
-			fmt.Printf("evaluation failed: %v\n", err)
-			return err
-		}
 	case EvalSilent:
 		_, err = interpreter.EvaluateWithoutPrinting(program)
-		if err != nil {
-			fmt.Printf("evaluation failed: %v\n", err)
-			return err
-		}
 	default:
-		fmt.Printf("Invalid evalMode.\n")
 		return errors.New("invalid eval")
 	}
-
-	// Save timestamps after successful execution
-	err = interpreter.saveTimestamps(TIMESTAMP_PATH, interpreter.timestamps)
-	if err != nil {
-		return err
-	}
-	return nil
+	return interpreter.finishBuild(mode, err)
 }
 
-// Updated RunSingleTask function
-func RunSingleTask(input string, taskName string, mode EvalMode) error {
-	err := os.MkdirAll("./.volt-build/", 0o755)
-	if err != nil {
-		return fmt.Errorf("failed to create .volt-build directory: %w", err)
-	}
-
-	gitignoreFile, err := os.Create("./.volt-build/.gitignore")
-	if err != nil {
-		fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
+// RunSingleTask runs one task of the script and its dependencies, ctx works the same as in RunTaskScript.
+func RunSingleTask(ctx context.Context, input string, taskName string, mode EvalMode, opts Options) error {
+	if err := createStateDir(); err != nil {
 		return err
 	}
-	_, err = gitignoreFile.WriteString("*")
+	program, err := parseScript(input)
 	if err != nil {
-		fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
 		return err
 	}
 
-	gitignoreFile.Close()
-
-	lexer := NewLexer(input)
-	parser := NewParser(lexer)
-	program := parser.ParseProgram()
-
-	if len(parser.errors) > 0 {
-		for _, err := range parser.errors {
-			fmt.Printf("%v\n", err)
-		}
-		return errors.New("parsing failed")
-	}
-
-	interpreter := NewInterpreter()
-	timestamps, err := interpreter.loadTimestamps(TIMESTAMP_PATH)
+	interpreter, err := newInterpreterFromOptions(ctx, mode, opts)
 	if err != nil {
-		fmt.Printf("Failed to load timestamps for incremental rebuilds: %v\n", err)
+		return err
 	}
-	interpreter.timestamps = timestamps
+	defer interpreter.startTrace(opts.TracePath)()
 
 	// Register tasks
 	for _, stmt := range program.Statements {
@@ -145,6 +108,16 @@ func RunSingleTask(input string, taskName string, mode EvalMode) error {
 		}
 	}
 
+	// Settings at the top of the script (variables, `shell = [...]`, `dir`, `env`, `dotenv`, `secret`) apply to the task too
+	for _, stmt := range program.Statements {
+		switch stmt.Type() {
+		case AssignmentNode, DirNode, EnvNode, DotenvNode, SecretNode:
+			if _, err := interpreter.EvaluateWithoutPrinting(stmt); err != nil {
+				return err
+			}
+		}
+	}
+
 	task, exists := interpreter.env.GetTask(taskName)
 	if !exists {
 		return fmt.Errorf("task does not exist: %s", taskName)
@@ -162,15 +135,121 @@ func RunSingleTask(input string, taskName string, mode EvalMode) error {
 	default:
 		return fmt.Errorf("invalid EvalMode")
 	}
+	return interpreter.finishBuild(mode, err)
+}
 
-	if err != nil {
-		return err
+// createStateDir creates .volt-build, which git is told to ignore.
+func createStateDir() error {
+	if err := os.MkdirAll(STATE_DIR, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", STATE_DIR, err)
 	}
+	return os.WriteFile(filepath.Join(STATE_DIR, ".gitignore"), []byte("*"), 0o644)
+}
 
-	// Save timestamps after execution
-	if saveErr := interpreter.saveTimestamps(TIMESTAMP_PATH, interpreter.timestamps); saveErr != nil {
-		return fmt.Errorf("failed to save timestamps: %w", saveErr)
+// parseScript parses a build script, the parse errors are logged.
+func parseScript(input string) (*Program, error) {
+	parser := NewParser(NewLexer(input))
+	program := parser.ParseProgram()
+
+	if len(parser.errors) > 0 {
+		for _, err := range parser.errors {
+			log.Printf("%v\n", err)
+		}
+		return nil, errors.New("parsing failed")
+	}
+	return program, nil
+}
+
+// newInterpreterFromOptions creates the interpreter for a build with the settings from the command line,
+// it knows what earlier builds did from .volt-build.
+func newInterpreterFromOptions(ctx context.Context, mode EvalMode, opts Options) (*Interpreter, error) {
+	interpreter := NewInterpreter()
+	interpreter.ctx = ctx
+	if mode == EvalSilent {
+		// the output of tasks still goes to their logs, it's only not shown
+		interpreter.stdout, interpreter.stderr = io.Discard, io.Discard
+	}
+	interpreter.keepGoing = opts.KeepGoing
+	interpreter.commandTimeout = opts.Timeout
+	if opts.Jobs > 0 {
+		interpreter.jobs = opts.Jobs
+	}
+	interpreter.shellOverride = opts.Shell
+	interpreter.outputMode = opts.Output
+	interpreter.sandboxAll = opts.Sandbox
+	if !opts.NoCache {
+		interpreter.cache = newLocalCache(CACHE_DIR, opts.CacheSize)
+		if opts.RemoteCache != "" {
+			var err error
+			if interpreter.remoteCache, err = newRemoteCache(opts.RemoteCache, opts.RemoteCacheReadOnly); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, file := range opts.EnvFiles {
+		if err := interpreter.loadDotenv(file, true); err != nil {
+			return nil, fmt.Errorf("failed to load env file: %w", err)
+		}
 	}
 
+	if err := interpreter.loadState(); err != nil {
+		fmt.Printf("Failed to load the state of earlier builds for incremental rebuilds: %v\n", err)
+	}
+	return interpreter, nil
+}
+
+// finishBuild reports the build and saves its state, err is what evaluating it returned.
+// The returned error has the secrets masked.
+func (i *Interpreter) finishBuild(mode EvalMode, err error) error {
+	var failed *failedTaskError
+	if err == nil || errors.As(err, &failed) {
+		err = i.keepGoingError()
+	}
+	i.reportBuild(mode, err)
+
+	if i.cache != nil {
+		if pruneErr := i.cache.pruneIfStored(); pruneErr != nil {
+			fmt.Printf("\x1b[1;33m[WARN]\x1b[0m failed to prune the cache: %v\n", pruneErr)
+		}
+	}
+
+	// The state is saved even if the build failed or was interrupted, only tasks that
+	// finished successfully have updated theirs so the work they did isn't lost.
+	if saveErr := i.saveState(); saveErr != nil {
+		return saveErr
+	}
+	return i.secrets.maskError(err)
+}
+
+// loadState loads what earlier builds found out about the inputs of tasks. What can't be loaded is
+// left empty, so the tasks it's about run again.
+func (i *Interpreter) loadState() error {
+	var errs []error
+	timestamps, err := i.loadTimestamps(TIMESTAMP_PATH)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("timestamps: %w", err))
+	} else {
+		i.timestamps = timestamps
+	}
+	if i.deps, err = loadDeps(DEPS_PATH); err != nil {
+		errs = append(errs, fmt.Errorf("depfile dependencies: %w", err))
+	}
+	if i.iterations, err = loadIterations(ITERATIONS_PATH); err != nil {
+		errs = append(errs, fmt.Errorf("foreach iterations: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// saveState saves what loadState loads, .volt-build has to exist.
+func (i *Interpreter) saveState() error {
+	if err := i.saveTimestamps(TIMESTAMP_PATH, i.timestamps); err != nil {
+		return fmt.Errorf("failed to save timestamps: %w", err)
+	}
+	if err := i.deps.save(DEPS_PATH); err != nil {
+		return fmt.Errorf("failed to save depfile dependencies: %w", err)
+	}
+	if err := i.iterations.save(ITERATIONS_PATH); err != nil {
+		return fmt.Errorf("failed to save foreach iterations: %w", err)
+	}
 	return nil
 }
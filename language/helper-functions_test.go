@@ -0,0 +1,94 @@
+package language
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inTempDir makes a new temporary directory the directory of volt-build for the rest of the test,
+// with the output of builds going nowhere.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+	return dir
+}
+
+// build runs script like `volt-build` does in the current directory.
+func build(t *testing.T, script string, opts Options) error {
+	t.Helper()
+	return RunTaskScript(context.Background(), script, EvalRegular, opts)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runs returns how often a task that appends a line to path for every run ran.
+func runs(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// readTrimmed returns the content of path without the trailing newline.
+func readTrimmed(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestFailedTaskRunsAgainWhenAnotherTaskSharesItsInputs(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	script := `
+task a input "in.txt" {
+    shell "echo a >> a.runs && exit 1"
+}
+task b input "in.txt" {
+    shell "echo b >> b.runs"
+}
+exec a
+exec b
+`
+	for run := 1; run <= 2; run++ {
+		if err := build(t, script, Options{KeepGoing: true}); err == nil {
+			t.Fatalf("build %d: succeeded although task a failed", run)
+		}
+		if got := runs(t, "a.runs"); got != run {
+			t.Fatalf("build %d: task a ran %d times, want %d", run, got, run)
+		}
+	}
+	if got := runs(t, "b.runs"); got != 1 {
+		t.Errorf("task b ran %d times, want 1", got)
+	}
+}
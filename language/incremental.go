@@ -0,0 +1,149 @@
+package language
+
+// this file makes `foreach ... output <expr>` incremental per file, like make: an iteration is skipped when its
+// output is newer than the file it's for (and the headers its depfile listed), and the loop and the variables it
+// sees are the same as when it last ran.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const ITERATIONS_PATH = ".volt-build/iterations.json"
+
+// iterationStore has the fingerprint of the loop every iteration with an output last ran with. It's shared by all forks.
+type iterationStore struct {
+	mu   sync.Mutex
+	done map[string]string // "task\tpattern\tfile" -> fingerprint
+}
+
+func loadIterations(path string) (*iterationStore, error) {
+	store := &iterationStore{done: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store.done); err != nil {
+		return &iterationStore{done: map[string]string{}}, err
+	}
+	return store, nil
+}
+
+func (s *iterationStore) save(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s.done, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *iterationStore) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[key]
+}
+
+func (s *iterationStore) set(key, fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done[key] = fingerprint
+}
+
+// forget removes the iterations of all loops in task.
+func (s *iterationStore) forget(task string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.done {
+		if strings.HasPrefix(key, task+"\t") {
+			delete(s.done, key)
+		}
+	}
+}
+
+func iterationKey(task, pattern, match string) string {
+	return task + "\t" + pattern + "\t" + match
+}
+
+// loopFingerprint hashes the loop and everything it sees, an iteration that ran with another one runs again.
+func (i *Interpreter) loopFingerprint(stmt *ForEachStatement) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", stmt)
+	if err := i.writeSettings(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pendingIterations returns the matches of a loop that have to run and a function to call after one of them ran
+// successfully. Loops without an output run every iteration. report prints how many files were up to date.
+func (i *Interpreter) pendingIterations(stmt *ForEachStatement, pattern string, matches []string, report bool) ([]string, func(match string), error) {
+	// a sandbox starts without the outputs of earlier builds, so everything has to run in it
+	if stmt.Output == nil || i.sandbox != nil {
+		return matches, func(string) {}, nil
+	}
+	fingerprint, err := i.loopFingerprint(stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending []string
+	for _, match := range matches {
+		if i.iterations.get(iterationKey(i.currentTask, pattern, match)) != fingerprint {
+			pending = append(pending, match)
+			continue
+		}
+
+		popScope := i.env.pushScope()
+		i.env.DefineVariable(stmt.VarName, match)
+		output, err := i.EvaluateWithoutPrinting(stmt.Output)
+		popScope()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: invalid output: %w", match, err)
+		}
+
+		if !i.upToDate(fmt.Sprintf("%v", output), match) {
+			pending = append(pending, match)
+		}
+	}
+
+	if skipped := len(matches) - len(pending); skipped > 0 && report {
+		fmt.Fprintf(i.stdout, "\x1b[1;32m[INFO]\x1b[0m %d of %d files of foreach %s are up to date\n", skipped, len(matches), pattern)
+	}
+
+	task := i.currentTask
+	done := func(match string) { i.iterations.set(iterationKey(task, pattern, match), fingerprint) }
+	return pending, done, nil
+}
+
+// upToDate reports if output exists and isn't older than source or what the depfile of source listed.
+func (i *Interpreter) upToDate(output, source string) bool {
+	info, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	built := info.ModTime()
+
+	newer := func(path string) bool {
+		info, err := os.Stat(path)
+		return err != nil || info.ModTime().After(built)
+	}
+	if newer(source) {
+		return false
+	}
+	for _, dep := range i.deps.source(i.currentTask, source) {
+		if newer(dep) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package language
+
+// this file turns the input patterns of tasks into files.
+
+import (
+	"fmt"
+)
+
+// expandInputs returns the files matched by the input patterns of task, without duplicates.
+// With warn set, patterns that match nothing are reported since that's usually a typo
+// or a file that some other task was supposed to generate.
+func expandInputs(task *TaskDef, warn bool) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+
+	opts := globOptions{exclude: task.Exclude, gitignore: task.Gitignore}
+	for _, pattern := range task.Inputs {
+		matches, err := glob(pattern, opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q of task %s: %w", pattern, task.Name, err)
+		}
+		if len(matches) == 0 && warn {
+			fmt.Printf("\x1b[1;33m[WARN]\x1b[0m input %q of task %s doesn't match any files\n", pattern, task.Name)
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+
+	return files, nil
+}
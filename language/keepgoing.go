@@ -0,0 +1,150 @@
+package language
+
+// this file contains the bookkeeping for keep-going mode (-k), where a failing task doesn't stop
+// the tasks that don't depend on it.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// taskFailure is kept for every task that failed or couldn't run, for the report at the end.
+type taskFailure struct {
+	task      string   // empty for a failing statement outside of any task
+	blockedBy []string // dependencies that failed, set when the task never ran
+	err       error
+}
+
+// failedTaskError is returned for a task that has already failed or been blocked,
+// so its dependents know not to run. The failure itself is in Interpreter.failures.
+type failedTaskError struct {
+	task string
+}
+
+func (e *failedTaskError) Error() string {
+	return fmt.Sprintf("task %s failed", e.task)
+}
+
+func (i *Interpreter) failureOf(task string) *taskFailure {
+	for _, f := range i.failures {
+		if f.task == task {
+			return f
+		}
+	}
+	return nil
+}
+
+// recordFailure marks task as failed with err. If err is only another task failing
+// (e.g. from an `exec` in the body), the task is marked as blocked by that task instead.
+func (i *Interpreter) recordFailure(task string, err error) error {
+	if f := i.failureOf(task); f != nil && task != "" {
+		return &failedTaskError{task: task}
+	}
+
+	var failed *failedTaskError
+	if errors.As(err, &failed) {
+		if task == "" {
+			return err // already recorded for the task that failed
+		}
+		return i.recordBlocked(task, []string{failed.task})
+	}
+
+	i.failures = append(i.failures, &taskFailure{task: task, err: err})
+	return &failedTaskError{task: task}
+}
+
+func (i *Interpreter) recordBlocked(task string, deps []string) error {
+	if f := i.failureOf(task); f != nil && task != "" {
+		return &failedTaskError{task: task}
+	}
+
+	i.failures = append(i.failures, &taskFailure{task: task, blockedBy: deps})
+	i.stats.addTask(task, taskBlocked, 0)
+	return &failedTaskError{task: task}
+}
+
+// runDependencies runs every dependency of task with runDep. Normally the first failure is returned,
+// in keep-going mode the remaining dependencies still run and the task is marked as blocked.
+func (i *Interpreter) runDependencies(task *TaskDef, runDep func(dep *TaskDef) error) error {
+	var failedDeps []string
+
+	for _, depName := range task.Dependencies {
+		dep, exists := i.env.GetTask(depName)
+		if !exists {
+			return fmt.Errorf("task %s doesn't exist", depName)
+		}
+
+		if err := runDep(dep); err != nil {
+			if !i.keepGoing {
+				return err
+			}
+			failedDeps = append(failedDeps, depName)
+		}
+	}
+
+	if len(failedDeps) > 0 {
+		return i.recordBlocked(task.Name, failedDeps)
+	}
+	return nil
+}
+
+// keepGoingError reports every failure, and turns them into the error returned for the run.
+func (i *Interpreter) keepGoingError() error {
+	if len(i.failures) == 0 {
+		return nil
+	}
+
+	failed, blocked := 0, 0
+	fmt.Printf("\n\x1b[1;31mfailures:\x1b[0m\n")
+	for _, f := range i.failures {
+		name := "task " + f.task
+		if f.task == "" {
+			name = "statement"
+		}
+
+		if len(f.blockedBy) > 0 {
+			blocked++
+			fmt.Printf("  %s blocked by %s\n", name, strings.Join(f.blockedBy, ", "))
+			continue
+		}
+
+		failed++
+		cmdErrs := commandErrors(f.err)
+		if len(cmdErrs) == 0 {
+			fmt.Printf("  %s: %v\n", name, i.secrets.maskError(f.err))
+		}
+		for _, cmdErr := range cmdErrs {
+			killed := ""
+			if cmdErr.signal != "" {
+				killed = fmt.Sprintf(" (killed by signal: %s)", cmdErr.signal)
+			}
+			fmt.Printf("  %s: `%s` exited with code %d%s\n", name, cmdErr.command, cmdErr.exitCode, killed)
+			for _, line := range strings.Split(strings.TrimRight(cmdErr.output, "\n"), "\n") {
+				if line != "" {
+					fmt.Printf("    | %s\n", line)
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("%d failed, %d blocked", failed, blocked)
+}
+
+// commandErrors returns the failed commands behind err, there can be several when
+// the iterations of a parallel foreach failed.
+func commandErrors(err error) []*commandError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var cmdErrs []*commandError
+		for _, e := range joined.Unwrap() {
+			cmdErrs = append(cmdErrs, commandErrors(e)...)
+		}
+		return cmdErrs
+	}
+
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return []*commandError{cmdErr}
+	}
+	return nil
+}
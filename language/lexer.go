@@ -189,6 +189,7 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '<':
 		if l.peekChar() == '=' {
+			l.readChar()
 			tok.Type = LORETO
 			tok.Literal = "<="
 		} else {
@@ -197,6 +198,7 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '>':
 		if l.peekChar() == '=' {
+			l.readChar()
 			tok.Type = GORETO
 			tok.Literal = ">="
 		} else {
@@ -205,6 +207,7 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '|':
 		if l.peekChar() == '|' {
+			l.readChar()
 			tok.Type = OR
 			tok.Literal = "||"
 		} else {
@@ -213,6 +216,7 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '&':
 		if l.peekChar() == '&' {
+			l.readChar()
 			tok.Type = AND
 			tok.Literal = "&&"
 		} else {
@@ -0,0 +1,199 @@
+package language
+
+// this file contains `foreach parallel`, which runs the iterations of a loop on a pool of workers.
+// Every iteration gets its own fork of the interpreter, so variables set in one don't leak into another.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+type outputChunk struct {
+	stderr bool
+	data   []byte
+}
+
+// orderedOutput prints the output of parallel iterations in iteration order. The oldest unfinished
+// iteration writes straight through, the ones after it are buffered until it's their turn.
+type orderedOutput struct {
+	mu      sync.Mutex
+	stdout  io.Writer // nil when the output is suppressed
+	stderr  io.Writer
+	next    int // the iteration that's currently allowed to write through
+	done    []bool
+	pending [][]outputChunk
+}
+
+func newOrderedOutput(stdout, stderr io.Writer, iterations int) *orderedOutput {
+	return &orderedOutput{
+		stdout:  stdout,
+		stderr:  stderr,
+		done:    make([]bool, iterations),
+		pending: make([][]outputChunk, iterations),
+	}
+}
+
+// iterationWriter is the stdout or stderr of a single iteration.
+type iterationWriter struct {
+	out    *orderedOutput
+	idx    int
+	stderr bool
+}
+
+func (w *iterationWriter) Write(p []byte) (int, error) {
+	o := w.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if w.idx == o.next {
+		o.write(outputChunk{stderr: w.stderr, data: p})
+	} else {
+		o.pending[w.idx] = append(o.pending[w.idx], outputChunk{stderr: w.stderr, data: slices.Clone(p)})
+	}
+	return len(p), nil
+}
+
+func (o *orderedOutput) writers(idx int) (stdout, stderr io.Writer) {
+	return &iterationWriter{out: o, idx: idx}, &iterationWriter{out: o, idx: idx, stderr: true}
+}
+
+// finish marks an iteration as done and flushes the output of the ones after it that are waiting.
+func (o *orderedOutput) finish(idx int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.done[idx] = true
+	for o.next < len(o.done) && o.done[o.next] {
+		o.next++
+		if o.next < len(o.done) {
+			for _, chunk := range o.pending[o.next] {
+				o.write(chunk)
+			}
+			o.pending[o.next] = nil
+		}
+	}
+}
+
+func (o *orderedOutput) write(chunk outputChunk) {
+	w := o.stdout
+	if chunk.stderr {
+		w = o.stderr
+	}
+	if w != nil {
+		w.Write(chunk.data)
+	}
+}
+
+// fork returns a copy of the interpreter for one iteration of a parallel loop, running on worker.
+// Tasks, stats and the trace are shared, everything that gets written to is copied, including the
+// variables of the outer scopes, so an iteration can't change them for the others.
+func (i *Interpreter) fork(worker int, stdout, stderr io.Writer) *Interpreter {
+	current, program := i.env.scope.clone()
+	f := *i
+	f.env = &Environment{
+		program:       program,
+		scope:         newScope(current),
+		tasks:         i.env.tasks,
+		progressDone:  i.env.progressDone,
+		progressTotal: i.env.progressTotal,
+		lastExitCode:  i.env.lastExitCode,
+	}
+	f.timestamps = maps.Clone(i.timestamps)
+	f.failures = slices.Clone(i.failures)
+	f.worker = worker
+	f.stdout, f.stderr = stdout, stderr
+	return &f
+}
+
+// merge takes over what a finished fork changed: timestamps of tasks it rebuilt, failures and progress.
+// progress is the progress count the fork started with.
+func (i *Interpreter) merge(f *Interpreter, progress int) {
+	for input, timestamp := range f.timestamps {
+		i.timestamps[input] = timestamp
+	}
+	for _, failure := range f.failures {
+		if !slices.Contains(i.failures, failure) && (failure.task == "" || i.failureOf(failure.task) == nil) {
+			i.failures = append(i.failures, failure)
+		}
+	}
+	i.env.progressDone += f.env.progressDone - progress
+}
+
+// evaluateForEachParallel runs body once for every match, at most i.jobs at a time. After a failure no new
+// iterations are started (unless in keep-going mode), the errors of all iterations that failed are returned.
+// done is called with the match of every iteration that succeeded.
+func (i *Interpreter) evaluateForEachParallel(stmt *ForEachStatement, matches []string, done func(match string), evalFn func(*Interpreter, Node) (any, error)) (any, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	out := newOrderedOutput(i.stdout, i.stderr, len(matches))
+	forks := make([]*Interpreter, len(matches))
+	errs := make([]error, len(matches))
+	var failed atomic.Bool
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(i.jobs, len(matches)) {
+		worker := int(i.workerIDs.Add(1))
+		i.tracer.nameThread(worker, fmt.Sprintf("worker %d", worker))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				if failed.Load() && !i.keepGoing {
+					out.finish(idx) // handed out just before another iteration failed
+					continue
+				}
+
+				stdout, stderr := out.writers(idx)
+				f := i.fork(worker, stdout, stderr)
+				f.env.DefineVariable(stmt.VarName, matches[idx])
+
+				if _, err := evalFn(f, stmt.Body); err != nil {
+					errs[idx] = fmt.Errorf("%s: %w", matches[idx], err)
+					failed.Store(true)
+				} else {
+					done(matches[idx])
+				}
+				forks[idx] = f
+				out.finish(idx)
+			}
+		}()
+	}
+
+	for idx := range matches {
+		if i.interrupted() != nil || (failed.Load() && !i.keepGoing) {
+			break
+		}
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+
+	// $? is left by the last iteration that failed or ended with a non-zero $?, by the last iteration if none did
+	progress := i.env.progressDone
+	anyFailed := false
+	for idx, f := range forks {
+		if f == nil {
+			continue
+		}
+		i.merge(f, progress)
+		failed := errs[idx] != nil || f.env.lastExitCode != 0
+		if failed || !anyFailed {
+			i.env.lastExitCode = f.env.lastExitCode
+			anyFailed = anyFailed || failed
+		}
+	}
+
+	if err := i.interrupted(); err != nil {
+		return nil, err
+	}
+	return nil, errors.Join(errs...)
+}
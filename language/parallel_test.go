@@ -0,0 +1,45 @@
+package language
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExitCodeAfterParallelForeach(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes string // exit code of the iterations for a.txt, b.txt and c.txt
+		want  string
+	}{
+		{"all succeed", "0 0 0", "0"},
+		{"last one fails", "0 0 5", "5"},
+		{"middle one fails", "0 3 0", "3"},
+		{"several fail", "4 3 0", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			codes := strings.Fields(tt.codes)
+			for idx, name := range []string{"a", "b", "c"} {
+				writeFile(t, "src/"+name+".txt", codes[idx])
+			}
+			script := `
+foreach parallel "src/*.txt" f {
+    shell "exit $(cat " ++ f ++ ")" || ignore
+}
+shell "echo " ++ $? ++ " > code.txt"
+`
+			if err := build(t, script, Options{Jobs: 3}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile("code.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(data)); got != tt.want {
+				t.Errorf("$? is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,9 @@ package language
 
 import (
 	"fmt"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Parser struct {
@@ -113,8 +113,34 @@ func (p *Parser) parseStatement() Node {
 		if p.peekTokenIs(ASSIGN) {
 			return p.parseAssignStatement()
 		}
+		if (p.currentToken.Literal == "global" || p.currentToken.Literal == "export") && p.peekTokenIs(IDENT) {
+			scope := p.currentToken.Literal
+			p.nextToken()
+			if !p.peekTokenIs(ASSIGN) {
+				p.errors = append(p.errors, fmt.Sprintf("Line %d, Column %d: expected `=` after %s %s", p.peekToken.Line, p.peekToken.Column, scope, p.currentToken.Literal))
+				return nil
+			}
+			stmt := p.parseAssignStatement()
+			stmt.Scope = scope
+			return stmt
+		}
 
+		if p.currentToken.Literal == "dir" {
+			return p.parseDirStatement()
+		}
+		if p.currentToken.Literal == "env" && p.peekTokenIs(LBRACE) {
+			return p.parseEnvStatement()
+		}
+		if p.currentToken.Literal == "dotenv" {
+			return p.parseDotenvStatement()
+		}
+		if p.currentToken.Literal == "secret" && p.peekTokenIs(IDENT) {
+			return p.parseSecretStatement()
+		}
 		if p.currentToken.Literal == "exec" {
+			if p.peekTokenIs(LBRACKET) {
+				return p.parseArgvStatement()
+			}
 			return p.parseExecStatement()
 		}
 		if p.currentToken.Literal == "shell" {
@@ -129,6 +155,11 @@ func (p *Parser) parseStatement() Node {
 		return nil
 	case COMPILE:
 		return p.parseCompileStatement()
+	case RUN:
+		if p.peekTokenIs(ASSIGN) {
+			return p.parseAssignStatement() // `shell = [...]` sets the shell for the task or the script
+		}
+		return p.parseShellStatement()
 	case IF:
 		return p.parseIfStatement()
 	case FOREACH:
@@ -149,7 +180,21 @@ func (p *Parser) parseCompileStatement() *CompileStatement {
 	p.nextToken()                   // move onto the next expression
 
 	stmt.Command = p.parseExpressionWithConcat()
-	return stmt
+
+	for {
+		if !p.parseCommandAttributes(&stmt.CommandAttributes) {
+			return nil
+		}
+		if !p.peekAttributeIs("depfile") {
+			return stmt
+		}
+		p.nextToken() // consume `depfile`
+		p.nextToken()
+		if stmt.Depfile = p.parseExpressionWithConcat(); stmt.Depfile == nil {
+			p.errorf("%d:%d: expected a file after depfile, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+			return nil
+		}
+	}
 }
 
 func (p *Parser) parseExpressionWithConcat() Node {
@@ -205,37 +250,187 @@ func (p *Parser) parseTaskDefinition() *TaskDef {
 	if p.peekTokenIs(INPUT) {
 		p.nextToken() // consume "input"
 
+		// the patterns are only expanded when the task runs, so files created
+		// by tasks that ran before it are picked up too.
+		task.Inputs = p.parsePatternList()
+		if task.Inputs == nil {
+			return nil
+		}
+	}
+
+	// the other attributes aren't keywords, so they can still be used as variable names.
+	for p.peekTokenIs(IDENT) {
+		p.nextToken()
+		if !p.parseTaskAttribute(task) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(LBRACE) {
+		return nil
+	}
+
+	task.Body = p.parseBlockStatement()
+	return task
+}
+
+// parseTaskAttribute parses one attribute in the header of a task, like `timeout "5m"`.
+func (p *Parser) parseTaskAttribute(task *TaskDef) bool {
+	switch p.currentToken.Literal {
+	case "timeout":
+		timeout, ok := p.parseDuration()
+		if !ok {
+			return false
+		}
+		task.Timeout = timeout
+	case "exclude":
+		task.Exclude = p.parsePatternList()
+		if task.Exclude == nil {
+			return false
+		}
+	case "gitignore":
+		task.Gitignore = true
+	case "sandbox":
+		task.Sandbox = true
+	case "output":
+		task.Outputs = p.parsePatternList()
+		if task.Outputs == nil {
+			return false
+		}
+	case "retry":
+		task.Retry = p.parseRetryPolicy()
+		if task.Retry == nil {
+			return false
+		}
+	default:
+		p.errorf("%d:%d: unknown attribute %q for task %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal, task.Name)
+		return false
+	}
+	return true
+}
+
+// parsePatternList parses one or more comma separated glob patterns after the current token.
+func (p *Parser) parsePatternList() []string {
+	var patterns []string
+	for {
 		if !p.expectPeek(STRING) {
 			return nil
 		}
+		if err := validatePattern(p.currentToken.Literal); err != nil {
+			p.errorf("%d:%d: invalid glob pattern %q: %v", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal, err)
+			return nil
+		}
+		patterns = append(patterns, p.currentToken.Literal)
+
+		if !p.peekTokenIs(COMMA) {
+			return patterns
+		}
+		p.nextToken()
+	}
+}
+
+// parseRetryPolicy parses `retry <count> [backoff "<duration>"] [on <code>, ...]`, with "retry" as the current token.
+func (p *Parser) parseRetryPolicy() *RetryPolicy {
+	policy := &RetryPolicy{}
+
+	if !p.expectPeek(NUMBER) {
+		return nil
+	}
+	count, err := strconv.Atoi(p.currentToken.Literal)
+	if err != nil || count < 0 {
+		p.errorf("%d:%d: retry count must be a whole number, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+		return nil
+	}
+	if count > maxRetries {
+		p.errorf("%d:%d: retry count can be at most %d, got %d", p.currentToken.Line, p.currentToken.Column, maxRetries, count)
+		return nil
+	}
+	policy.Count = count
 
-		globbedSlice, err := filepath.Glob(p.currentToken.Literal)
-		if err != nil {
-			p.errorf("error making glob pattern: %v\n", err)
+	if p.peekTokenIs(IDENT) && p.peekToken.Literal == "backoff" {
+		p.nextToken()
+		backoff, ok := p.parseDuration()
+		if !ok {
 			return nil
 		}
-		task.Inputs = append(task.Inputs, globbedSlice...)
+		policy.Backoff = backoff
+	}
 
-		for p.peekTokenIs(COMMA) {
-			p.nextToken()
-			if !p.expectPeek(STRING) {
+	if p.peekTokenIs(IDENT) && p.peekToken.Literal == "on" {
+		p.nextToken()
+		for {
+			if !p.expectPeek(NUMBER) {
 				return nil
 			}
-			globbedSlice, err = filepath.Glob(p.currentToken.Literal)
+			code, err := strconv.Atoi(p.currentToken.Literal)
 			if err != nil {
-				p.errorf("error making glob pattern: %v\n", err)
+				p.errorf("%d:%d: exit code must be a whole number, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
 				return nil
 			}
-			task.Inputs = append(task.Inputs, globbedSlice...)
+			policy.ExitCodes = append(policy.ExitCodes, code)
+
+			if !p.peekTokenIs(COMMA) {
+				break
+			}
+			p.nextToken()
 		}
 	}
 
-	if !p.expectPeek(LBRACE) {
-		return nil
+	return policy
+}
+
+// parseCommandAttributes parses `retry ...`, `allow_failure`, `|| ignore` and `as <name>` after a command.
+func (p *Parser) parseCommandAttributes(attrs *CommandAttributes) bool {
+	for {
+		switch {
+		case p.peekAttributeIs("retry"):
+			p.nextToken()
+			if attrs.Retry = p.parseRetryPolicy(); attrs.Retry == nil {
+				return false
+			}
+		case p.peekAttributeIs("allow_failure"):
+			p.nextToken()
+			attrs.AllowFailure = true
+		case p.peekTokenIs(OR) && p.peekToken.Line == p.currentToken.Line:
+			p.nextToken()
+			if !p.expectPeek(IDENT) {
+				return false
+			}
+			if p.currentToken.Literal != "ignore" {
+				p.errorf("%d:%d: expected `ignore` after `||`, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+				return false
+			}
+			attrs.AllowFailure = true
+		case p.peekAttributeIs("as"):
+			p.nextToken()
+			if !p.expectPeek(IDENT) {
+				return false
+			}
+			attrs.Status = p.currentToken.Literal
+		default:
+			return true
+		}
 	}
+}
 
-	task.Body = p.parseBlockStatement()
-	return task
+// peekAttributeIs checks if the next token is the attribute `name` on the same line as the current token.
+// Attributes after a statement have to stay on its line, so they aren't mistaken for the next statement.
+func (p *Parser) peekAttributeIs(name string) bool {
+	return p.peekTokenIs(IDENT) && p.peekToken.Literal == name && p.peekToken.Line == p.currentToken.Line
+}
+
+// parseDuration parses the string after the current token as a duration like "1m30s".
+func (p *Parser) parseDuration() (time.Duration, bool) {
+	if !p.expectPeek(STRING) {
+		return 0, false
+	}
+
+	duration, err := time.ParseDuration(p.currentToken.Literal)
+	if err != nil {
+		p.errorf("%d:%d: invalid duration %q: %v", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal, err)
+		return 0, false
+	}
+	return duration, true
 }
 
 func (p *Parser) parseBlockStatement() *BlockStatement {
@@ -265,11 +460,100 @@ func (p *Parser) parseExecStatement() *ExecStatement {
 	return stmt
 }
 
+func (p *Parser) parseArgvStatement() *ArgvStatement {
+	stmt := &ArgvStatement{}
+	p.nextToken() // consume `exec`
+	if stmt.Args = p.parseExpression(); stmt.Args == nil {
+		return nil
+	}
+
+	if !p.parseCommandAttributes(&stmt.CommandAttributes) {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseDirStatement() *DirStatement {
+	stmt := &DirStatement{}
+	p.nextToken() // consume `dir`
+	if stmt.Path = p.parseExpression(); stmt.Path == nil {
+		p.errorf("%d:%d: expected a directory after dir, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+		return nil
+	}
+	return stmt
+}
+
+// parseEnvStatement parses `env { NAME = value ... }`, the entries can be separated by newlines or commas.
+func (p *Parser) parseEnvStatement() *EnvStatement {
+	stmt := &EnvStatement{}
+	p.nextToken() // consume `env`
+
+	for !p.peekTokenIs(RBRACE) {
+		if !p.expectPeek(IDENT) {
+			return nil
+		}
+		entry := EnvEntry{Name: p.currentToken.Literal}
+		if !p.expectPeek(ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		if entry.Value = p.parseExpression(); entry.Value == nil {
+			p.errorf("%d:%d: expected a value for %s, got %s", p.currentToken.Line, p.currentToken.Column, entry.Name, p.currentToken.Literal)
+			return nil
+		}
+		stmt.Entries = append(stmt.Entries, entry)
+
+		if p.peekTokenIs(COMMA) {
+			p.nextToken()
+		}
+	}
+	p.nextToken() // consume `}`
+	return stmt
+}
+
+// parseSecretStatement parses `secret NAME, NAME...`.
+func (p *Parser) parseSecretStatement() *SecretStatement {
+	stmt := &SecretStatement{}
+	for {
+		if !p.expectPeek(IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, p.currentToken.Literal)
+
+		if !p.peekTokenIs(COMMA) {
+			return stmt
+		}
+		p.nextToken()
+	}
+}
+
+// parseDotenvStatement parses `dotenv file, file...`.
+func (p *Parser) parseDotenvStatement() *DotenvStatement {
+	stmt := &DotenvStatement{}
+	for {
+		p.nextToken()
+		file := p.parseExpression()
+		if file == nil {
+			p.errorf("%d:%d: expected a file after dotenv, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+			return nil
+		}
+		stmt.Files = append(stmt.Files, file)
+
+		if !p.peekTokenIs(COMMA) {
+			return stmt
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseShellStatement() *ShellStatement {
 	stmt := &ShellStatement{}
 	p.nextToken()
 	stmt.Command = p.parseExpression()
 
+	if !p.parseCommandAttributes(&stmt.CommandAttributes) {
+		return nil
+	}
 	return stmt
 }
 
@@ -285,6 +569,13 @@ func (p *Parser) parseIfStatement() *IfStatement {
 
 	p.nextToken() // consume if
 	stmt.Condition = p.parseExpression()
+	if p.peekTokenIs(EQUAL) || p.peekTokenIs(NOTEQUAL) {
+		p.nextToken()
+		comparison := &ComparisonOperation{Left: stmt.Condition, Operator: p.currentToken.Literal}
+		p.nextToken()
+		comparison.Right = p.parseExpression()
+		stmt.Condition = comparison
+	}
 
 	if !p.expectPeek(LBRACE) {
 		return nil
@@ -309,6 +600,11 @@ func (p *Parser) parseForEachStatement() *ForEachStatement {
 
 	p.nextToken() // consume `foreach`
 
+	if p.currentTokenIs(IDENT) && p.currentToken.Literal == "parallel" {
+		stmt.Parallel = true
+		p.nextToken()
+	}
+
 	if !p.currentTokenIs(STRING) && !p.currentTokenIs(IDENT) {
 		p.errors = append(p.errors, fmt.Sprintf("Line %d, Column %d: expected string or identifier, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal))
 		return nil
@@ -317,13 +613,27 @@ func (p *Parser) parseForEachStatement() *ForEachStatement {
 	stmt.Pattern = p.currentToken.Literal
 	stmt.VarName = "it"
 
-	if p.peekTokenIs(IDENT) {
+	// like the attributes of tasks, `exclude`, `gitignore` and `output` are always attributes here,
+	// anything else is the name of the loop variable.
+	hasVar := false
+	for p.peekTokenIs(IDENT) {
 		p.nextToken()
-		varName := p.currentToken.Literal
-		if string(varName[0]) == "$" {
-			varName = varName[1:]
+		switch p.currentToken.Literal {
+		case "exclude", "gitignore", "output":
+			if !p.parseForEachAttribute(stmt) {
+				return nil
+			}
+		case "parallel":
+			p.errorf("%d:%d: parallel goes right after foreach, like `foreach parallel \"src/*.c\" cfile {`", p.currentToken.Line, p.currentToken.Column)
+			return nil
+		default:
+			if hasVar {
+				p.errorf("%d:%d: unexpected %s after the loop variable %s, expected an attribute or {", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal, stmt.VarName)
+				return nil
+			}
+			hasVar = true
+			stmt.VarName = strings.TrimPrefix(p.currentToken.Literal, "$")
 		}
-		stmt.VarName = varName
 	}
 
 	if !p.expectPeek(LBRACE) {
@@ -333,6 +643,31 @@ func (p *Parser) parseForEachStatement() *ForEachStatement {
 	return stmt
 }
 
+// parseForEachAttribute parses one attribute in the header of a foreach loop, the current token.
+func (p *Parser) parseForEachAttribute(stmt *ForEachStatement) bool {
+	switch p.currentToken.Literal {
+	case "exclude":
+		stmt.Exclude = p.parsePatternList()
+		return stmt.Exclude != nil
+	case "gitignore":
+		stmt.Gitignore = true
+	case "output":
+		stmt.Output = p.parseForEachOutput()
+		return stmt.Output != nil
+	}
+	return true
+}
+
+// parseForEachOutput parses the expression after `output`, the current token.
+func (p *Parser) parseForEachOutput() Node {
+	p.nextToken()
+	output := p.parseExpressionWithConcat()
+	if output == nil {
+		p.errorf("%d:%d: expected a file after output, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+	}
+	return output
+}
+
 func (p *Parser) parseAssignStatement() *AssignmentStatement {
 	stmt := &AssignmentStatement{
 		Name: p.currentToken.Literal,
@@ -355,7 +690,24 @@ func (p *Parser) parseExpression() Node {
 		value, _ := strconv.ParseFloat(p.currentToken.Literal, 64)
 		left = &NumberLiteral{Value: value}
 	case IDENT:
-		left = &Identifier{Value: p.currentToken.Literal}
+		if p.peekTokenIs(LPAREN) {
+			call := &CallExpression{Function: p.currentToken.Literal}
+			p.nextToken()
+			args, ok := p.parseExpressionList(RPAREN)
+			if !ok {
+				return nil
+			}
+			call.Args = args
+			left = call
+		} else {
+			left = &Identifier{Value: p.currentToken.Literal}
+		}
+	case LBRACKET:
+		elements, ok := p.parseExpressionList(RBRACKET)
+		if !ok {
+			return nil
+		}
+		left = &ListLiteral{Elements: elements}
 	case SHELL:
 		p.nextToken() // consume '$'
 		left = &ShellExpr{Name: p.currentToken.Literal}
@@ -378,3 +730,28 @@ func (p *Parser) parseExpression() Node {
 
 	return left
 }
+
+// parseExpressionList parses comma separated expressions up to end, with the opening `[` or `(` as
+// the current token. A trailing comma is allowed.
+func (p *Parser) parseExpressionList(end TokenType) ([]Node, bool) {
+	var list []Node
+	for !p.peekTokenIs(end) {
+		p.nextToken()
+		elem := p.parseExpression()
+		if elem == nil {
+			p.errorf("%d:%d: expected a value, got %s", p.currentToken.Line, p.currentToken.Column, p.currentToken.Literal)
+			return nil, false
+		}
+		list = append(list, elem)
+
+		if !p.peekTokenIs(COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil, false
+	}
+	return list, true
+}
@@ -0,0 +1,117 @@
+package language
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseShellStatements(t *testing.T) {
+	parser := NewParser(NewLexer(`
+shell "echo top"
+task t {
+    shell "echo task"
+}
+`))
+	program := parser.ParseProgram()
+	if len(parser.errors) > 0 {
+		t.Fatalf("parse errors: %v", parser.errors)
+	}
+
+	var commands []string
+	var collect func(stmts []Node)
+	collect = func(stmts []Node) {
+		for _, stmt := range stmts {
+			switch stmt := stmt.(type) {
+			case *ShellStatement:
+				if command, ok := stmt.Command.(*StringLiteral); ok {
+					commands = append(commands, command.Value)
+				}
+			case *TaskDef:
+				if body, ok := stmt.Body.(*BlockStatement); ok {
+					collect(body.Statements)
+				}
+			}
+		}
+	}
+	collect(program.Statements)
+
+	want := []string{"echo top", "echo task"}
+	if !slices.Equal(commands, want) {
+		t.Errorf("got shell statements %q, want %q", commands, want)
+	}
+}
+
+func TestParseForEachHeader(t *testing.T) {
+	tests := []struct {
+		header    string
+		parallel  bool
+		pattern   string
+		varName   string
+		exclude   []string
+		gitignore bool
+		output    string
+	}{
+		{header: `foreach "*.c"`, pattern: "*.c", varName: "it"},
+		{header: `foreach "*.c" cfile`, pattern: "*.c", varName: "cfile"},
+		{header: `foreach files f`, pattern: "files", varName: "f"},
+		{header: `foreach parallel "*.c" cfile`, parallel: true, pattern: "*.c", varName: "cfile"},
+		{header: `foreach parallel files`, parallel: true, pattern: "files", varName: "it"},
+		{header: `foreach "*.c" exclude "a.c", "b.c" cfile`, pattern: "*.c", varName: "cfile", exclude: []string{"a.c", "b.c"}},
+		{header: `foreach "*.c" cfile exclude "a.c"`, pattern: "*.c", varName: "cfile", exclude: []string{"a.c"}},
+		{header: `foreach "*.c" gitignore`, pattern: "*.c", varName: "it", gitignore: true},
+		{header: `foreach "*.c" gitignore cfile`, pattern: "*.c", varName: "cfile", gitignore: true},
+		{header: `foreach "*.c" output it ++ ".o"`, pattern: "*.c", varName: "it", output: `it ++ ".o"`},
+		{header: `foreach parallel "*.c" exclude "a.c" gitignore cfile output cfile ++ ".o"`,
+			parallel: true, pattern: "*.c", varName: "cfile", exclude: []string{"a.c"}, gitignore: true, output: `cfile ++ ".o"`},
+	}
+	for _, tt := range tests {
+		stmt := parseForEach(t, tt.header+` { shell "true" }`)
+		if stmt == nil {
+			continue
+		}
+		output := ""
+		if stmt.Output != nil {
+			output = stmt.Output.String()
+		}
+		if stmt.Parallel != tt.parallel || stmt.Pattern != tt.pattern || stmt.VarName != tt.varName ||
+			!slices.Equal(stmt.Exclude, tt.exclude) || stmt.Gitignore != tt.gitignore || output != tt.output {
+			t.Errorf("%s: got parallel %v, pattern %q, var %q, exclude %q, gitignore %v, output %q", tt.header,
+				stmt.Parallel, stmt.Pattern, stmt.VarName, stmt.Exclude, stmt.Gitignore, output)
+		}
+	}
+
+	for _, header := range []string{
+		`foreach "*.c" exclude`,
+		`foreach "*.c" exclude cfile`,
+		`foreach "*.c" output`,
+		`foreach "*.c" cfile parallel`,
+		`foreach "*.c" a b`,
+		`foreach parallel`,
+	} {
+		parser := NewParser(NewLexer(header + ` { shell "true" }`))
+		parser.ParseProgram()
+		if len(parser.errors) == 0 {
+			t.Errorf("%s: parsed without errors", header)
+		}
+	}
+}
+
+func parseForEach(t *testing.T, script string) *ForEachStatement {
+	t.Helper()
+	parser := NewParser(NewLexer(script))
+	program := parser.ParseProgram()
+	if len(parser.errors) > 0 {
+		t.Errorf("%s: %v", script, parser.errors)
+		return nil
+	}
+	if len(program.Statements) != 1 {
+		t.Errorf("%s: got %d statements", script, len(program.Statements))
+		return nil
+	}
+	stmt, ok := program.Statements[0].(*ForEachStatement)
+	if !ok {
+		t.Errorf("%s: got %T", script, program.Statements[0])
+		return nil
+	}
+	return stmt
+}
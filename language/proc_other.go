@@ -0,0 +1,12 @@
+//go:build !unix
+
+package language
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups aren't available,
+// cancelling the command only kills the process itself.
+func setProcessGroup(cmd *exec.Cmd) (exited func()) { return func() {} }
+
+// signalOf only knows about signals on unix.
+func signalOf(err error) (int, string) { return 0, "" }
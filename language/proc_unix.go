@@ -0,0 +1,58 @@
+//go:build unix
+
+package language
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts the command in its own process group, so everything it spawns
+// (compilers, test binaries, ...) can be stopped together with it. Cancelling the command
+// sends SIGTERM to the group, and SIGKILL if it's still around after killDelay. cmd.WaitDelay
+// makes sure Wait returns even if the group ignores both.
+// The returned function has to be called once Wait returned, after that the group id can belong
+// to another process group so the SIGKILL mustn't be sent anymore.
+func setProcessGroup(cmd *exec.Cmd) (exited func()) {
+	var mu sync.Mutex
+	var kill *time.Timer
+	done := false
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		mu.Lock()
+		if !done {
+			kill = time.AfterFunc(killDelay, func() {
+				_ = syscall.Kill(pgid, syscall.SIGKILL)
+			})
+		}
+		mu.Unlock()
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		done = true
+		if kill != nil {
+			kill.Stop()
+		}
+	}
+}
+
+// signalOf returns the number and name of the signal that killed the process behind err, 0 if there wasn't one.
+func signalOf(err error) (int, string) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, ""
+	}
+	return int(status.Signal()), status.Signal().String()
+}
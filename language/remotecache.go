@@ -0,0 +1,189 @@
+package language
+
+// this file contains the remote cache, an HTTP server with the layout of bazel-remote's HTTP cache:
+// GET/PUT <url>/ac/<key> for cache entries and <url>/cas/<sha256> for the contents of files.
+// Entries are the JSON of the local cache, so bazel-remote needs --disable_http_ac_validation.
+// Everything goes through the local cache, the remote one is only asked when it doesn't have an entry.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const remoteCacheTimeout = 10 * time.Minute // for a single request, artifacts can be big
+
+var errNotInCache = errors.New("not in the remote cache")
+
+type remoteCache struct {
+	base     *url.URL
+	readOnly bool // only download, for machines that shouldn't publish what they build
+	client   *http.Client
+
+	mu       sync.Mutex
+	disabled bool // set after the server couldn't be reached, so the build doesn't wait on it for every task
+}
+
+func newRemoteCache(rawURL string, readOnly bool) (*remoteCache, error) {
+	base, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote cache url: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid remote cache url %q, expected http:// or https://", rawURL)
+	}
+	return &remoteCache{
+		base:     base,
+		readOnly: readOnly,
+		client:   &http.Client{Timeout: remoteCacheTimeout},
+	}, nil
+}
+
+func (r *remoteCache) url(kind, hash string) string {
+	return r.base.JoinPath(kind, hash).String()
+}
+
+// usable reports if the remote cache should still be asked. Only the first failure to reach it is
+// reported to w, after that the build goes on without it.
+func (r *remoteCache) usable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.disabled
+}
+
+func (r *remoteCache) failed(w io.Writer, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.disabled {
+		return
+	}
+	r.disabled = true
+	fmt.Fprintf(w, "\x1b[1;33m[WARN]\x1b[0m remote cache %s isn't used for the rest of the build: %v\n", r.base.Redacted(), err)
+}
+
+// get downloads the body of <kind>/<hash> into w.
+func (r *remoteCache) get(ctx context.Context, kind, hash string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url(kind, hash), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotInCache
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("GET %s/%s: %s", kind, hash, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// exists asks the server if it has <kind>/<hash> without downloading it.
+func (r *remoteCache) exists(ctx context.Context, kind, hash string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, r.url(kind, hash), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (r *remoteCache) put(ctx context.Context, kind, hash string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.url(kind, hash), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT %s/%s: %s", kind, hash, resp.Status)
+	}
+	return nil
+}
+
+// fetch downloads the entry for key and the files it needs into the local cache. An entry that would
+// write anything but the outputs of task is rejected before anything is downloaded.
+func (r *remoteCache) fetch(ctx context.Context, key string, task *TaskDef, local *localCache) (*cacheEntry, error) {
+	var buf bytes.Buffer
+	if err := r.get(ctx, "ac", key, &buf); err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		return nil, fmt.Errorf("invalid entry for %s: %w", key, err)
+	}
+	if err := checkEntry(task, &entry); err != nil {
+		return nil, fmt.Errorf("invalid entry for %s: %w", key, err)
+	}
+
+	err := local.add(key, &entry, func(hash string, w io.Writer) error {
+		h := sha256.New()
+		if err := r.get(ctx, "cas", hash, io.MultiWriter(w, h)); err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != hash {
+			return fmt.Errorf("cas/%s has the wrong content (sha256 %s)", hash, got)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// upload puts an entry of the local cache and its files that the server doesn't have yet on the server.
+// The entry goes last, so nobody can get it before its files are there.
+func (r *remoteCache) upload(ctx context.Context, key string, entry *cacheEntry, local *localCache) error {
+	for _, file := range entry.Files {
+		exists, err := r.exists(ctx, "cas", file.Hash)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		f, err := os.Open(local.blobPath(file.Hash))
+		if err != nil {
+			return err
+		}
+		err = r.put(ctx, "cas", file.Hash, f, file.Size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return r.put(ctx, "ac", key, bytes.NewReader(data), int64(len(data)))
+}
@@ -0,0 +1,200 @@
+package language
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRemoteCache is a bazel-remote like HTTP cache in memory.
+type fakeRemoteCache struct {
+	mu    sync.Mutex
+	files map[string][]byte // by "ac/<key>" and "cas/<hash>"
+	puts  int
+}
+
+func newFakeRemoteCache(t *testing.T) (*fakeRemoteCache, string) {
+	cache := &fakeRemoteCache{files: map[string][]byte{}}
+	server := httptest.NewServer(cache)
+	t.Cleanup(server.Close)
+	return cache, server.URL
+}
+
+func (c *fakeRemoteCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		data, ok := c.files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		c.files[name] = data
+		c.puts++
+	}
+}
+
+// entry returns the key and the entry of the only action cache entry.
+func (c *fakeRemoteCache) entry(t *testing.T) (string, cacheEntry) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var key string
+	var entry cacheEntry
+	for name, data := range c.files {
+		if k, ok := strings.CutPrefix(name, "ac/"); ok {
+			if key != "" {
+				t.Fatalf("more than one entry in the remote cache")
+			}
+			key = k
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if key == "" {
+		t.Fatalf("no entry in the remote cache")
+	}
+	return key, entry
+}
+
+func (c *fakeRemoteCache) set(t *testing.T, name string, data any) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := data.([]byte); ok {
+		c.files[name] = b
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.files[name] = b
+}
+
+const remoteCacheScript = `
+task gen input "in.txt" output "out/gen.txt" {
+    shell "mkdir -p out && echo generated > out/gen.txt && echo run >> gen.runs"
+}
+exec gen
+`
+
+// buildOnOtherMachine builds the script without the outputs and state of earlier builds.
+func buildOnOtherMachine(t *testing.T, opts Options) {
+	t.Helper()
+	for _, dir := range []string{STATE_DIR, "out"} {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := build(t, remoteCacheScript, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("out/gen.txt")
+	if err != nil || string(data) != "generated\n" {
+		t.Fatalf("out/gen.txt is %q (%v), want %q", data, err, "generated\n")
+	}
+}
+
+func TestRemoteCache(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	remote, url := newFakeRemoteCache(t)
+
+	// miss: the task runs and is uploaded
+	buildOnOtherMachine(t, Options{RemoteCache: url})
+	if got := runs(t, "gen.runs"); got != 1 {
+		t.Fatalf("task ran %d times on a miss, want 1", got)
+	}
+	_, entry := remote.entry(t)
+
+	// hit: the outputs come from the remote cache
+	buildOnOtherMachine(t, Options{RemoteCache: url})
+	if got := runs(t, "gen.runs"); got != 1 {
+		t.Fatalf("task ran again although the remote cache had it")
+	}
+
+	// read-only: nothing is uploaded
+	writeFile(t, "in.txt", "changed\n")
+	puts := remote.puts
+	buildOnOtherMachine(t, Options{RemoteCache: url, RemoteCacheReadOnly: true})
+	if got := runs(t, "gen.runs"); got != 2 {
+		t.Fatalf("task ran %d times after its input changed, want 2", got)
+	}
+	if remote.puts != puts {
+		t.Errorf("%d uploads in read-only mode", remote.puts-puts)
+	}
+	writeFile(t, "in.txt", "input\n")
+
+	// corrupt blob: the task runs instead
+	blob := "cas/" + entry.Files[0].Hash
+	remote.set(t, blob, []byte("corrupted\n"))
+	buildOnOtherMachine(t, Options{RemoteCache: url, RemoteCacheReadOnly: true})
+	if got := runs(t, "gen.runs"); got != 3 {
+		t.Fatalf("task ran %d times with a corrupt blob in the remote cache, want 3", got)
+	}
+	remote.set(t, blob, []byte("generated\n"))
+}
+
+func TestRemoteCacheRejectsHostileEntries(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	remote, url := newFakeRemoteCache(t)
+	buildOnOtherMachine(t, Options{RemoteCache: url})
+	key, entry := remote.entry(t)
+	valid := entry.Files[0]
+
+	evil := []byte("#!/bin/sh\necho pwned\n")
+	sum := sha256.Sum256(evil)
+	evilHash := hex.EncodeToString(sum[:])
+	remote.set(t, "cas/"+evilHash, evil)
+	outside := filepath.Join(filepath.Dir(dir), "evil.sh")
+
+	tests := []struct {
+		name  string
+		files []cachedFile
+	}{
+		{"outside", []cachedFile{valid, {Path: "../evil.sh", Hash: evilHash, Mode: 0o755}}},
+		{"absolute", []cachedFile{valid, {Path: outside, Hash: evilHash, Mode: 0o755}}},
+		{"not clean", []cachedFile{valid, {Path: "out/../in.txt", Hash: evilHash, Mode: 0o644}}},
+		{"not an output", []cachedFile{valid, {Path: "in.txt", Hash: evilHash, Mode: 0o644}}},
+		{"setuid", []cachedFile{{Path: valid.Path, Hash: evilHash, Mode: os.ModeSetuid | 0o755}}},
+		{"hash", []cachedFile{{Path: valid.Path, Hash: "../../ac/" + key, Mode: 0o644}}},
+		{"uppercase hash", []cachedFile{{Path: valid.Path, Hash: strings.ToUpper(valid.Hash), Mode: 0o644}}},
+		{"missing output", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runs(t, "gen.runs")
+			remote.set(t, "ac/"+key, cacheEntry{Task: "gen", Files: tt.files})
+			buildOnOtherMachine(t, Options{RemoteCache: url, RemoteCacheReadOnly: true})
+
+			if got := runs(t, "gen.runs"); got != before+1 {
+				t.Errorf("task didn't run, the entry was used")
+			}
+			if _, err := os.Stat(outside); err == nil {
+				t.Errorf("%s was written", outside)
+			}
+			if data, _ := os.ReadFile("in.txt"); string(data) != "input\n" {
+				t.Errorf("in.txt was overwritten with %q", data)
+			}
+			if data, _ := os.ReadFile(valid.Path); string(data) != "generated\n" {
+				t.Errorf("%s is %q", valid.Path, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package language
+
+// this file contains sandboxed tasks. Their commands run in a temporary directory that only has the
+// declared inputs in it, and only the declared outputs are copied back, so a task that reads or creates
+// files it doesn't declare fails instead of making incremental builds and the cache lie. It's not a
+// security boundary, commands can still reach everything through absolute paths.
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type sandbox struct {
+	root string // stands for the directory of volt-build
+}
+
+// newSandbox creates the sandbox of task with its inputs symlinked into it, copied where symlinks don't work.
+// Inputs outside the directory of volt-build are left where they are.
+func newSandbox(task *TaskDef) (*sandbox, error) {
+	inputs, err := expandInputs(task, false)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.MkdirTemp("", "volt-build-"+task.Name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the sandbox of task %s: %w", task.Name, err)
+	}
+	sb := &sandbox{root: root}
+
+	for _, input := range inputs {
+		rel, ok := sb.relative(input)
+		if !ok {
+			continue
+		}
+		abs, err := filepath.Abs(input)
+		if err == nil {
+			err = sb.link(abs, filepath.Join(root, rel))
+		}
+		if err != nil {
+			sb.remove()
+			return nil, fmt.Errorf("failed to put input %s in the sandbox of task %s: %w", input, task.Name, err)
+		}
+	}
+	return sb, nil
+}
+
+// enterSandbox creates the sandbox of task if it runs in one and moves the current scope into it,
+// which has to be the scope of the task. It returns nil if the task doesn't run in a sandbox.
+func (i *Interpreter) enterSandbox(task *TaskDef) (*sandbox, error) {
+	if !task.Sandbox && !i.sandboxAll {
+		return nil, nil
+	}
+	sb, err := newSandbox(task)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := sb.workDir(i.env.workDir())
+	if err != nil {
+		sb.remove()
+		return nil, err
+	}
+	i.env.scope.dir = dir
+	return sb, nil
+}
+
+// outsideSandbox turns a path in the sandbox of the running task into the path of the same file outside of it.
+func (i *Interpreter) outsideSandbox(path string) string {
+	if i.sandbox == nil || !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(i.sandbox.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// relative returns path relative to the directory of volt-build, if it's inside it.
+func (sb *sandbox) relative(path string) (string, bool) {
+	if filepath.IsAbs(path) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", false
+		}
+		if path, err = filepath.Rel(cwd, path); err != nil {
+			return "", false
+		}
+	}
+	path = filepath.Clean(path)
+	if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// link puts src at dst in the sandbox, directories are linked as a whole.
+func (sb *sandbox) link(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Symlink(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(dst, 0o755)
+	}
+	return copyFile(src, dst, info.Mode().Perm())
+}
+
+// workDir returns the directory in the sandbox that stands for dir, creating it if needed.
+func (sb *sandbox) workDir(dir string) (string, error) {
+	rel, ok := sb.relative(dir)
+	if !ok {
+		return "", fmt.Errorf("dir %s is outside of the sandbox", dir)
+	}
+	dir = filepath.Join(sb.root, rel)
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// collect copies the outputs of task out of the sandbox, every output pattern has to match something.
+func (sb *sandbox) collect(task *TaskDef) error {
+	for _, pattern := range task.Outputs {
+		matches, err := glob(filepath.Join(sb.root, pattern), globOptions{})
+		if err != nil {
+			return fmt.Errorf("invalid output pattern %q: %w", pattern, err)
+		}
+
+		copied := 0
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				// symlinks are the inputs, only files the task created are outputs
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				rel, err := filepath.Rel(sb.root, path)
+				if err != nil {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				copied++
+				return copyFile(path, rel, info.Mode().Perm())
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy output %s out of the sandbox: %w", match, err)
+			}
+		}
+		if copied == 0 {
+			return fmt.Errorf("output %q of task %s wasn't created in its sandbox, is an input missing?", pattern, task.Name)
+		}
+	}
+	return nil
+}
+
+func (sb *sandbox) remove() {
+	os.RemoveAll(sb.root)
+}
@@ -0,0 +1,21 @@
+package language
+
+import "testing"
+
+func TestCompileOfUndeclaredFileFailsInSandbox(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "main.c", "#include \"undeclared.h\"\n")
+	writeFile(t, "undeclared.h", "int x;\n")
+	script := `
+task build input "main.c" {
+    compile "undeclared.h" "cat"
+}
+exec build
+`
+	if err := build(t, script, Options{Sandbox: true}); err == nil {
+		t.Error("compiling a file that isn't an input succeeded in the sandbox")
+	}
+	if err := build(t, script, Options{}); err != nil {
+		t.Errorf("without a sandbox: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package language
+
+// this file contains variable scopes. The program has one scope, every task body, block and loop
+// iteration gets a new one on top of it, and a task only sees the program scope, not the scope of the caller.
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// shellSetting is the variable set by `shell = [...]`, it can't clash with other variables since `shell` is a keyword.
+const shellSetting = "shell"
+
+type scope struct {
+	variables map[string]any
+	exported  map[string]bool // variables that are also set in the environment of commands
+	parent    *scope          // nil for the program scope
+	task      bool            // the outermost scope of a task body
+	dir       string          // set by `dir`, the working directory of commands
+	env       map[string]any  // set by `env { }`, extra environment variables of commands
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		variables: make(map[string]any),
+		exported:  make(map[string]bool),
+		parent:    parent,
+	}
+}
+
+// lookup finds the innermost scope that has the variable.
+func (s *scope) lookup(name string) (*scope, bool) {
+	for ; s != nil; s = s.parent {
+		if _, exists := s.variables[name]; exists {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// clone copies the scope and all its parents, it returns the copy and the copy of the program scope.
+func (s *scope) clone() (current, program *scope) {
+	if s == nil {
+		return nil, nil
+	}
+	parent, program := s.parent.clone()
+	current = &scope{
+		variables: maps.Clone(s.variables),
+		exported:  maps.Clone(s.exported),
+		parent:    parent,
+		task:      s.task,
+		dir:       s.dir,
+		env:       maps.Clone(s.env),
+	}
+	if program == nil {
+		program = current
+	}
+	return current, program
+}
+
+// pushScope starts a new scope inside the current one, the returned function goes back to the current one.
+func (env *Environment) pushScope() func() {
+	prev := env.scope
+	env.scope = newScope(prev)
+	return func() { env.scope = prev }
+}
+
+// pushTaskScope starts the scope of a task body, which only has the program scope around it.
+func (env *Environment) pushTaskScope() func() {
+	prev := env.scope
+	env.scope = newScope(env.program)
+	env.scope.task = true
+	return func() { env.scope = prev }
+}
+
+// DefineVariable creates the variable in the current scope, shadowing any outer one with the same name.
+func (env *Environment) DefineVariable(name string, value any) {
+	env.scope.variables[name] = value
+}
+
+// SetGlobal assigns the variable in the program scope, so every task sees it.
+func (env *Environment) SetGlobal(name string, value any) {
+	env.program.variables[name] = value
+}
+
+// Export assigns the variable like SetVariable and also passes it to the commands run in its scope.
+func (env *Environment) Export(name string, value any) {
+	env.SetVariable(name, value)
+	s, _ := env.scope.lookup(name)
+	s.exported[name] = true
+}
+
+// exports returns the exported variables and `env { }` entries visible in the current scope, inner ones win.
+func (env *Environment) exports() map[string]any {
+	var chain []*scope
+	for s := env.scope; s != nil; s = s.parent {
+		chain = append(chain, s)
+	}
+
+	exports := map[string]any{}
+	for idx := len(chain) - 1; idx >= 0; idx-- {
+		maps.Copy(exports, chain[idx].env)
+		for name := range chain[idx].exported {
+			exports[name] = chain[idx].variables[name]
+		}
+	}
+	return exports
+}
+
+// visible returns the variables visible in the current scope, inner ones win.
+func (env *Environment) visible() map[string]any {
+	var chain []*scope
+	for s := env.scope; s != nil; s = s.parent {
+		chain = append(chain, s)
+	}
+
+	variables := map[string]any{}
+	for idx := len(chain) - 1; idx >= 0; idx-- {
+		maps.Copy(variables, chain[idx].variables)
+	}
+	return variables
+}
+
+// workDir returns the directory set by the innermost `dir`, or "" for the directory of volt-build.
+func (env *Environment) workDir() string {
+	for s := env.scope; s != nil; s = s.parent {
+		if s.dir != "" {
+			return s.dir
+		}
+	}
+	return ""
+}
+
+// setWorkDir sets the directory for the commands in the current scope.
+func (env *Environment) setWorkDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(env.workDir(), dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dir: %s is not a directory", dir)
+	}
+	env.scope.dir = dir
+	return nil
+}
+
+// setEnv sets an environment variable for the commands in the current scope.
+func (env *Environment) setEnv(name string, value any) {
+	if env.scope.env == nil {
+		env.scope.env = make(map[string]any)
+	}
+	env.scope.env[name] = value
+}
+
+// commandEnv returns the environment for a command, nil (the environment of volt-build) if nothing is exported.
+func (i *Interpreter) commandEnv() []string {
+	exports := i.env.exports()
+	if len(exports) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for name, value := range exports {
+		env = append(env, fmt.Sprintf("%s=%v", name, value))
+	}
+	return env
+}
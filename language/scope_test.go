@@ -0,0 +1,161 @@
+package language
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTaskDoesNotSeeTheScopeOfItsCaller(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	err := build(t, `
+task t input "in.txt" {
+    shell "echo " ++ y ++ " > t.txt"
+}
+foreach "in.txt" f {
+    y = "loop"
+    exec t
+}
+`, Options{})
+	if err == nil || !strings.Contains(err.Error(), "y not found") {
+		t.Errorf("got %v, want y not to be found inside the task", err)
+	}
+	if _, err := os.Stat("t.txt"); err == nil {
+		t.Error("the task ran with the variables of the loop calling it")
+	}
+}
+
+func TestAssigningInTaskShadowsUnlessGlobal(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	err := build(t, `
+x = "script"
+task a input "in.txt" {
+    x = "a"
+    shell "echo " ++ x ++ " > a.txt"
+}
+task b input "in.txt" {
+    shell "echo " ++ x ++ " > b.txt"
+}
+task g input "in.txt" {
+    global x = "g"
+}
+task c input "in.txt" {
+    shell "echo " ++ x ++ " > c.txt"
+}
+exec a
+exec b
+exec g
+exec c
+shell "echo " ++ x ++ " > script.txt"
+`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"a.txt":      "a",      // the task's own x
+		"b.txt":      "script", // a's x was gone after a
+		"c.txt":      "g",      // g changed the script's x
+		"script.txt": "g",
+	} {
+		if got := readTrimmed(t, file); got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestExportReachesCommands(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	err := build(t, `
+export X = "script"
+task t input "in.txt" {
+    export Y = "task"
+    shell "echo $X $Y > t.txt"
+}
+exec t
+shell "echo $X ${Y:-unset} > script.txt"
+`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTrimmed(t, "t.txt"); got != "script task" {
+		t.Errorf("in the task: got %q, want %q", got, "script task")
+	}
+	if got := readTrimmed(t, "script.txt"); got != "script unset" {
+		t.Errorf("after the task: got %q, want the export of the task to be gone", got)
+	}
+}
+
+func TestLoopVariablesStayInTheLoop(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "a.txt", "a\n")
+	writeFile(t, "b.txt", "b\n")
+
+	for _, name := range []string{"f", "last"} {
+		err := build(t, `
+foreach "*.txt" f {
+    last = f
+    shell "echo " ++ f ++ " >> seen"
+}
+shell "echo " ++ `+name+`
+`, Options{})
+		if err == nil || !strings.Contains(err.Error(), name+" not found") {
+			t.Errorf("%s: got %v, want it not to be found after the loop", name, err)
+		}
+	}
+	if got := runs(t, "seen"); got != 4 {
+		t.Errorf("the loop ran %d times over two builds, want 4", got)
+	}
+}
+
+func TestDirAndEnvApplyToCommands(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	if err := os.Mkdir("sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := build(t, `
+env { A = "script" }
+task t input "in.txt" {
+    dir "sub"
+    env {
+        B = "task"
+    }
+    shell "pwd > where.txt && echo $A $B > env.txt"
+}
+exec t
+shell "pwd > where.txt && echo $A ${B:-unset} > env.txt"
+`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the real path, the temp directory can be behind a symlink
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, where, env string
+	}{
+		{"sub", filepath.Join(root, "sub"), "script task"},
+		{".", root, "script unset"},
+	}
+	for _, tt := range tests {
+		where, err := filepath.EvalSymlinks(readTrimmed(t, filepath.Join(tt.dir, "where.txt")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if where != tt.where {
+			t.Errorf("%s: ran in %s, want %s", tt.dir, where, tt.where)
+		}
+		if got := readTrimmed(t, filepath.Join(tt.dir, "env.txt")); got != tt.env {
+			t.Errorf("%s: got environment %q, want %q", tt.dir, got, tt.env)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package language
+
+// this file hides the values of `secret` variables, they are replaced with *** in everything
+// volt-build prints or writes to its logs, and in the output of commands.
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	secretMask      = "***"
+	maxMaskedLine   = 64 * 1024 // a line without a newline that gets this long is masked and written anyway
+	secretMinLength = 3         // shorter values would mask too much unrelated output
+)
+
+// masker replaces secret values, it's shared by all forks of an interpreter.
+type masker struct {
+	mu       sync.RWMutex
+	names    map[string]bool // variables marked with `secret`, the values they get later are secret too
+	values   []string
+	replacer *strings.Replacer
+}
+
+func (m *masker) addName(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.names == nil {
+		m.names = make(map[string]bool)
+	}
+	m.names[name] = true
+}
+
+func (m *masker) secretName(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.names[name]
+}
+
+// add marks value as secret. Output is masked line by line, so every line of a multi-line value is masked on its own.
+func (m *masker) add(value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < secretMinLength || slices.Contains(m.values, line) {
+			continue
+		}
+		m.values = append(m.values, line)
+	}
+
+	// longer values first, so a secret containing another one is masked as a whole
+	slices.SortFunc(m.values, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	pairs := make([]string, 0, 2*len(m.values))
+	for _, v := range m.values {
+		pairs = append(pairs, v, secretMask)
+	}
+	m.replacer = strings.NewReplacer(pairs...)
+}
+
+// active reports if there is anything to mask.
+func (m *masker) active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.replacer != nil
+}
+
+func (m *masker) mask(s string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.replacer == nil {
+		return s
+	}
+	return m.replacer.Replace(s)
+}
+
+// maskError masks the message of err, the error it wraps is still there for errors.Is/As.
+func (m *masker) maskError(err error) error {
+	if err == nil || !m.active() {
+		return err
+	}
+	return &maskedError{err: err, m: m}
+}
+
+type maskedError struct {
+	err error
+	m   *masker
+}
+
+func (e *maskedError) Error() string { return e.m.mask(e.err.Error()) }
+func (e *maskedError) Unwrap() error { return e.err }
+
+// maskWriter masks whole lines, so a secret split between two writes is still found.
+// Flush writes what's left after the last newline.
+type maskWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	m   *masker
+	buf []byte
+}
+
+func (m *masker) writer(w io.Writer) *maskWriter {
+	return &maskWriter{w: w, m: m}
+}
+
+func (mw *maskWriter) Write(p []byte) (int, error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	mw.buf = append(mw.buf, p...)
+	end := bytes.LastIndexAny(mw.buf, "\r\n") + 1
+	if end == 0 && len(mw.buf) < maxMaskedLine {
+		return len(p), nil
+	}
+	if end == 0 {
+		end = len(mw.buf)
+	}
+
+	if _, err := io.WriteString(mw.w, mw.m.mask(string(mw.buf[:end]))); err != nil {
+		return 0, err
+	}
+	mw.buf = append(mw.buf[:0], mw.buf[end:]...)
+	return len(p), nil
+}
+
+func (mw *maskWriter) Flush() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if len(mw.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(mw.w, mw.m.mask(string(mw.buf)))
+	mw.buf = mw.buf[:0]
+	return err
+}
+
+// markSecret marks a variable, or an environment variable if there is no variable with that name, as secret.
+// Nothing needs to be masked if neither exists, e.g. a token that's only set on CI.
+// Values assigned to the name later are masked as well, see assigned.
+func (i *Interpreter) markSecret(name string) {
+	i.secrets.addName(name)
+	val, exists := i.env.GetVariable(name)
+	if !exists {
+		val, exists = i.env.exports()[name]
+	}
+	if !exists {
+		val, exists = os.LookupEnv(name)
+	}
+	if exists {
+		i.addSecret(val)
+	}
+}
+
+// assigned is called whenever a variable or environment variable gets a value, a secret one's new value is masked too.
+func (i *Interpreter) assigned(name string, val any) {
+	if i.secrets.secretName(name) {
+		i.addSecret(val)
+	}
+}
+
+// addSecret marks a value as secret, every item of a list on its own.
+func (i *Interpreter) addSecret(val any) {
+	if list, ok := val.([]string); ok {
+		for _, item := range list {
+			i.secrets.add(item)
+		}
+		return
+	}
+	i.secrets.add(fmt.Sprintf("%v", val))
+}
@@ -0,0 +1,44 @@
+package language
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecretsStayMaskedWhenReassigned(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	writeFile(t, ".env", "TOKEN=from-dotenv\n")
+	script := `
+TOKEN = "first-value"
+secret TOKEN
+TOKEN = "second-value"
+export TOKEN = "exported-value"
+task a input "in.txt" {
+    shell "echo $TOKEN"
+    env {
+        TOKEN = "env-value"
+    }
+    shell "echo $TOKEN"
+    dotenv ".env"
+    shell "echo $TOKEN"
+}
+exec a
+`
+	if err := build(t, script, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(".volt-build/logs/a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"first-value", "second-value", "exported-value", "env-value", "from-dotenv"} {
+		if strings.Contains(string(log), value) {
+			t.Errorf("log contains %q:\n%s", value, log)
+		}
+	}
+	if got := strings.Count(string(log), secretMask); got < 3 {
+		t.Errorf("log has %d masked values, want 3:\n%s", got, log)
+	}
+}
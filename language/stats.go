@@ -0,0 +1,302 @@
+package language
+
+// this file keeps track of how long tasks and commands take, prints the summary at the end of a build
+// and keeps a history of builds for `volt-build stats`.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HISTORY_PATH  = ".volt-build/history.json"
+	historyLength = 100 // number of builds kept in the history file
+	slowestShown  = 5   // number of commands listed under "slowest commands"
+)
+
+type taskStatus string
+
+const (
+	taskRebuilt taskStatus = "rebuilt"
+	taskSkipped taskStatus = "skipped"
+	taskFailed  taskStatus = "failed"
+	taskBlocked taskStatus = "blocked" // not run because a dependency failed, in keep-going mode
+	taskCached  taskStatus = "cached"  // outputs restored from the cache instead of running
+)
+
+type taskStat struct {
+	Name     string        `json:"name"`
+	Status   taskStatus    `json:"status"`
+	Duration time.Duration `json:"duration"`
+}
+
+type commandStat struct {
+	Task     string        `json:"task"`
+	Kind     string        `json:"kind"`
+	Command  string        `json:"command"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed"`
+}
+
+// buildRecord is what gets saved in the history file for every build.
+type buildRecord struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed"`
+	Tasks    []taskStat    `json:"tasks"`
+	Slowest  []commandStat `json:"slowest"`
+}
+
+// buildStats is shared by everything evaluating the same build, so it is locked.
+type buildStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	tasks    []taskStat
+	commands []commandStat
+}
+
+func newBuildStats() *buildStats {
+	return &buildStats{start: time.Now()}
+}
+
+// statusRank orders statuses by what a task that was executed more than once in a build (as the dependency
+// of several tasks) is listed as, a task that ran once and was skipped later ran.
+var statusRank = map[taskStatus]int{taskSkipped: 0, taskBlocked: 1, taskCached: 2, taskRebuilt: 3, taskFailed: 4}
+
+// addTask records that a task was executed, a task executed again adds to its earlier row.
+func (s *buildStats) addTask(name string, status taskStatus, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for idx := range s.tasks {
+		if t := &s.tasks[idx]; t.Name == name {
+			t.Duration += duration
+			if statusRank[status] > statusRank[t.Status] {
+				t.Status = status
+			}
+			return
+		}
+	}
+	s.tasks = append(s.tasks, taskStat{Name: name, Status: status, Duration: duration})
+}
+
+func (s *buildStats) addCommand(stat commandStat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, stat)
+}
+
+func (s *buildStats) slowest(n int) []commandStat {
+	sorted := make([]commandStat, len(s.commands))
+	copy(sorted, s.commands)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Duration > sorted[b].Duration
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func (s *buildStats) record(failed bool) buildRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return buildRecord{
+		Start:    s.start,
+		Duration: time.Since(s.start),
+		Failed:   failed,
+		Tasks:    append([]taskStat(nil), s.tasks...),
+		Slowest:  s.slowest(slowestShown),
+	}
+}
+
+// printSummary prints the end-of-build table, in verbose mode every command is listed as well.
+func (s *buildStats) printSummary(rec buildRecord, verbose bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[taskStatus]int{}
+	for _, t := range rec.Tasks {
+		counts[t.Status]++
+	}
+
+	fmt.Printf("\n\x1b[1mbuild summary\x1b[0m\n")
+	fmt.Printf("tasks: %d run, %d skipped, %d failed", counts[taskRebuilt], counts[taskSkipped], counts[taskFailed])
+	if counts[taskCached] > 0 {
+		fmt.Printf(", %d cached", counts[taskCached])
+	}
+	if counts[taskBlocked] > 0 {
+		fmt.Printf(", %d blocked", counts[taskBlocked])
+	}
+	fmt.Printf("\n")
+
+	for _, t := range rec.Tasks {
+		fmt.Printf("  %-24s %-8s %10s\n", t.Name, t.Status, formatDuration(t.Duration))
+		if !verbose {
+			continue
+		}
+		for _, c := range s.commands {
+			if c.Task == t.Name {
+				fmt.Printf("    %10s  %s\n", formatDuration(c.Duration), c.Command)
+			}
+		}
+	}
+
+	if len(rec.Slowest) > 0 {
+		fmt.Printf("slowest commands:\n")
+		for _, c := range rec.Slowest {
+			fmt.Printf("  %10s  [%s] %s\n", formatDuration(c.Duration), c.Task, c.Command)
+		}
+	}
+
+	status := "\x1b[1;32mok\x1b[0m"
+	if rec.Failed {
+		status = "\x1b[1;31mfailed\x1b[0m"
+	}
+	fmt.Printf("total: %s (%s)\n", formatDuration(rec.Duration), status)
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
+
+// reportBuild prints the summary (unless silent) and appends the build to the history file.
+func (i *Interpreter) reportBuild(mode EvalMode, err error) {
+	rec := i.stats.record(err != nil)
+	if mode != EvalSilent {
+		i.stats.printSummary(rec, mode == EvalVerbose)
+	}
+
+	if err := appendHistory(HISTORY_PATH, rec); err != nil {
+		fmt.Printf("\x1b[1;31merror:\x1b[0m failed to save build history: %v\n", err)
+	}
+}
+
+func loadHistory(path string) ([]buildRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var history []buildRecord
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func appendHistory(path string, rec buildRecord) error {
+	history, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+
+	history = append(history, rec)
+	if len(history) > historyLength {
+		history = history[len(history)-historyLength:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// PrintStats shows the last `runs` builds from the history and how long each task took across them.
+func PrintStats(runs int) error {
+	history, err := loadHistory(HISTORY_PATH)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		fmt.Printf("no builds recorded yet\n")
+		return nil
+	}
+	if runs > 0 && len(history) > runs {
+		history = history[len(history)-runs:]
+	}
+
+	fmt.Printf("\x1b[1mlast %d builds\x1b[0m\n", len(history))
+	for _, rec := range history {
+		status := "ok"
+		if rec.Failed {
+			status = "failed"
+		}
+		fmt.Printf("  %s  %10s  %s\n", rec.Start.Format("2006-01-02 15:04:05"), formatDuration(rec.Duration), status)
+	}
+
+	type trend struct {
+		runs            int
+		total, min, max time.Duration
+		last            time.Duration
+		skipped, cached int
+		failed          int
+	}
+	trends := map[string]*trend{}
+	var names []string
+	for _, rec := range history {
+		for _, t := range rec.Tasks {
+			tr, ok := trends[t.Name]
+			if !ok {
+				tr = &trend{}
+				trends[t.Name] = tr
+				names = append(names, t.Name)
+			}
+			switch t.Status {
+			case taskSkipped, taskBlocked:
+				tr.skipped++
+				continue
+			case taskCached:
+				tr.cached++ // restoring isn't running, it would drag the timings down
+				continue
+			case taskFailed:
+				tr.failed++
+			}
+			if tr.runs == 0 || t.Duration < tr.min {
+				tr.min = t.Duration
+			}
+			tr.runs++
+			tr.total += t.Duration
+			tr.last = t.Duration
+			tr.max = max(tr.max, t.Duration)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Printf("\n\x1b[1mtasks\x1b[0m\n")
+	fmt.Printf("  %-24s %5s %8s %7s %7s %10s %10s %10s %10s\n", "name", "runs", "skipped", "cached", "failed", "last", "avg", "min", "max")
+	for _, name := range names {
+		tr := trends[name]
+		avg := time.Duration(0)
+		if tr.runs > 0 {
+			avg = tr.total / time.Duration(tr.runs)
+		}
+		fmt.Printf("  %-24s %5d %8d %7d %7d %10s %10s %10s %10s\n",
+			name, tr.runs, tr.skipped, tr.cached, tr.failed,
+			formatDuration(tr.last), formatDuration(avg), formatDuration(tr.min), formatDuration(tr.max))
+	}
+
+	last := history[len(history)-1]
+	if len(last.Slowest) > 0 {
+		fmt.Printf("\n\x1b[1mslowest commands of the last build\x1b[0m\n")
+		for _, c := range last.Slowest {
+			fmt.Printf("  %10s  [%s] %s\n", formatDuration(c.Duration), c.Task, strings.TrimSpace(c.Command))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package language
+
+// this file captures the output of every task. It's saved to .volt-build/logs/<task>.log and
+// shown with the lines prefixed with the task name, grouped per task, or as it is.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const LOGS_DIR = ".volt-build/logs"
+
+// OutputMode is how the output of tasks is shown.
+type OutputMode int
+
+const (
+	OutputPrefixed OutputMode = iota // every line starts with [task]
+	OutputGrouped                    // the output of a task is shown at once when it's done
+	OutputPlain                      // as the commands write it
+)
+
+// ParseOutputMode parses the value of --output.
+func ParseOutputMode(s string) (OutputMode, error) {
+	switch s {
+	case "prefix", "":
+		return OutputPrefixed, nil
+	case "group":
+		return OutputGrouped, nil
+	case "plain":
+		return OutputPlain, nil
+	}
+	return 0, fmt.Errorf("unknown output mode %q, expected prefix, group or plain", s)
+}
+
+// taskOutput is where the output of a running task goes, tasks run by it write into it too.
+type taskOutput struct {
+	mu      sync.Mutex
+	mode    OutputMode
+	prefix  []byte
+	stdout  io.Writer // nil when the output is suppressed
+	stderr  io.Writer
+	log     *os.File // nil if the log couldn't be created
+	midLine [2]bool  // if stdout/stderr ended without a newline, so the next write doesn't get a prefix
+	grouped []outputChunk
+}
+
+func logPath(task string) string {
+	return filepath.Join(LOGS_DIR, task+".log")
+}
+
+// newTaskOutput starts capturing the output of a task, the log of its last run is replaced.
+func newTaskOutput(task string, mode OutputMode, stdout, stderr io.Writer) *taskOutput {
+	out := &taskOutput{
+		mode:   mode,
+		prefix: []byte("\x1b[2m[" + task + "]\x1b[0m "),
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	err := os.MkdirAll(LOGS_DIR, 0o755)
+	if err == nil {
+		out.log, err = os.Create(logPath(task))
+	}
+	if err != nil {
+		fmt.Printf("\x1b[1;33m[WARN]\x1b[0m output of task %s isn't logged: %v\n", task, err)
+	}
+	return out
+}
+
+// taskWriter is the stdout or stderr of a task.
+type taskWriter struct {
+	out    *taskOutput
+	stderr bool
+}
+
+func (o *taskOutput) writers() (stdout, stderr io.Writer) {
+	return &taskWriter{out: o}, &taskWriter{out: o, stderr: true}
+}
+
+func (w *taskWriter) Write(p []byte) (int, error) {
+	o := w.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.log != nil {
+		o.log.Write(p)
+	}
+
+	switch o.mode {
+	case OutputGrouped:
+		o.grouped = append(o.grouped, outputChunk{stderr: w.stderr, data: slices.Clone(p)})
+	case OutputPrefixed:
+		o.write(outputChunk{stderr: w.stderr, data: o.prefixLines(w.stderr, p)})
+	default:
+		o.write(outputChunk{stderr: w.stderr, data: p})
+	}
+	return len(p), nil
+}
+
+// prefixLines puts the prefix in front of every line in p that starts in it.
+func (o *taskOutput) prefixLines(stderr bool, p []byte) []byte {
+	stream := 0
+	if stderr {
+		stream = 1
+	}
+
+	var buf bytes.Buffer
+	for len(p) > 0 {
+		if !o.midLine[stream] {
+			buf.Write(o.prefix)
+		}
+		line, rest, found := bytes.Cut(p, []byte("\n"))
+		buf.Write(line)
+		if found {
+			buf.WriteByte('\n')
+		}
+		o.midLine[stream] = !found
+		p = rest
+	}
+	return buf.Bytes()
+}
+
+func (o *taskOutput) write(chunk outputChunk) {
+	w := o.stdout
+	if chunk.stderr {
+		w = o.stderr
+	}
+	if w != nil {
+		w.Write(chunk.data)
+	}
+}
+
+// close shows the grouped output and closes the log.
+func (o *taskOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, chunk := range o.grouped {
+		o.write(chunk)
+	}
+	o.grouped = nil
+	if o.log != nil {
+		o.log.Close()
+	}
+}
+
+// PrintTaskLog prints the output of the last run of a task, or lists the logs there are if task is "".
+func PrintTaskLog(task string) error {
+	if task != "" {
+		data, err := os.ReadFile(logPath(task))
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no log for task %s, it hasn't run yet", task)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	entries, err := os.ReadDir(LOGS_DIR)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("no task logs yet\n")
+		return nil
+	}
+
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Name() < entries[b].Name() })
+	fmt.Printf("\x1b[1mtask logs\x1b[0m\n")
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+		fmt.Printf("  %-24s %s  %d bytes\n", strings.TrimSuffix(entry.Name(), ".log"), info.ModTime().Format("2006-01-02 15:04:05"), info.Size())
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package language
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestTaskLogInSilentMode(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "in.txt", "input\n")
+	script := `
+task a input "in.txt" {
+    shell "echo from shell"
+    exec ["echo", "from exec"]
+}
+exec a
+`
+	if err := RunTaskScript(context.Background(), script, EvalSilent, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(logPath("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "from shell\nfrom exec\n"; string(log) != want {
+		t.Errorf("log is %q, want %q", log, want)
+	}
+}
@@ -0,0 +1,134 @@
+package language
+
+// this file records a timeline of the build in the Chrome Trace Event format,
+// so it can be opened in about:tracing or https://ui.perfetto.dev
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// traceEvent is one entry of the "traceEvents" array.
+// See: https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`  // "X" for complete events, "M" for metadata
+	Ts   int64          `json:"ts"`  // microseconds since the start of the build
+	Dur  int64          `json:"dur"` // microseconds
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"` // worker the event ran on
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type traceSpan struct {
+	name  string
+	cat   string
+	tid   int
+	start time.Time
+}
+
+// tracer is safe to use from multiple goroutines, and a nil *tracer records nothing.
+type tracer struct {
+	mu      sync.Mutex
+	start   time.Time
+	events  []traceEvent
+	threads map[int]string
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		start:   time.Now(),
+		threads: make(map[int]string),
+	}
+}
+
+// nameThread gives a worker a readable name in the timeline.
+func (t *tracer) nameThread(tid int, name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threads[tid] = name
+}
+
+func (t *tracer) begin(cat, name string, tid int) *traceSpan {
+	if t == nil {
+		return nil
+	}
+	return &traceSpan{name: name, cat: cat, tid: tid, start: time.Now()}
+}
+
+func (t *tracer) end(span *traceSpan, args map[string]any) {
+	if t == nil || span == nil {
+		return
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, traceEvent{
+		Name: span.name,
+		Cat:  span.cat,
+		Ph:   "X",
+		Ts:   span.start.Sub(t.start).Microseconds(),
+		Dur:  now.Sub(span.start).Microseconds(),
+		Pid:  1,
+		Tid:  span.tid,
+		Args: args,
+	})
+}
+
+func (t *tracer) writeFile(path string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make([]traceEvent, 0, len(t.events)+len(t.threads)+1)
+	events = append(events, traceEvent{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  1,
+		Args: map[string]any{"name": "volt-build"},
+	})
+	for tid, name := range t.threads {
+		events = append(events, traceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  tid,
+			Args: map[string]any{"name": name},
+		})
+	}
+	events = append(events, t.events...)
+
+	data, err := json.Marshal(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// startTrace turns on tracing when path is set, the returned function writes the trace out.
+func (i *Interpreter) startTrace(path string) func() {
+	if path == "" {
+		return func() {}
+	}
+	i.tracer = newTracer()
+	i.tracer.nameThread(i.worker, "main")
+
+	return func() {
+		if err := i.tracer.writeFile(path); err != nil {
+			fmt.Printf("\x1b[1;31merror:\x1b[0m failed to write trace: %v\n", err)
+		}
+	}
+}
@@ -3,9 +3,14 @@ package language
 // this file contains utils and the main run.
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,7 +18,8 @@ const TIMESTAMP_PATH = ".volt-build/timestamps.json"
 
 // TODO: add progress feedback
 type Environment struct {
-	variables     map[string]any      // variables inside the script
+	program       *scope              // variables of the whole script, see scope.go
+	scope         *scope              // innermost scope of what's being evaluated
 	tasks         map[string]*TaskDef // tasks to be executed
 	progressDone  int                 // increment after all the compile/shell statements
 	progressTotal int                 // total needed to be done
@@ -21,20 +27,36 @@ type Environment struct {
 }
 
 func NewEnvironment() *Environment {
+	program := newScope(nil)
 	return &Environment{
-		variables:    make(map[string]any),
+		program:      program,
+		scope:        program,
 		tasks:        make(map[string]*TaskDef),
 		lastExitCode: 0,
 	}
 }
 
+// SetVariable assigns to the variable if the task (or the program, outside of tasks) already has it,
+// otherwise it's created in the current scope. Use SetGlobal to assign to a program variable from a task.
 func (env *Environment) SetVariable(name string, value any) {
-	env.variables[name] = value
+	for s := env.scope; s != nil; s = s.parent {
+		if _, exists := s.variables[name]; exists {
+			s.variables[name] = value
+			return
+		}
+		if s.task {
+			break // the program scope is outside of the task
+		}
+	}
+	env.scope.variables[name] = value
 }
 
 func (env *Environment) GetVariable(name string) (any, bool) {
-	value, exists := env.variables[name]
-	return value, exists
+	s, exists := env.scope.lookup(name)
+	if !exists {
+		return nil, false
+	}
+	return s.variables[name], true
 }
 
 func (env *Environment) RegisterTask(task *TaskDef) {
@@ -47,24 +69,67 @@ func (env *Environment) GetTask(name string) (*TaskDef, bool) {
 }
 
 type Interpreter struct {
-	env        *Environment
-	timestamps map[string]time.Time
+	ctx         context.Context // cancelled when the task (or the whole build) has to stop
+	env         *Environment
+	timestamps  map[string]time.Time
+	tracer      *tracer     // nil unless a trace was requested
+	stats       *buildStats // timings for the end-of-build summary
+	worker      int         // id of the worker this interpreter runs on, used as the trace tid
+	currentTask string      // name of the task whose body is being evaluated
+	keepGoing   bool        // keep running independent tasks after a failure
+	failures    []*taskFailure
+
+	commandTimeout time.Duration // limit for every single command, 0 means none
+	taskRetry      *RetryPolicy  // retry policy of the running task, for commands without their own
+
+	stdout        io.Writer // where pushes and command output go, buffered per iteration in parallel loops
+	stderr        io.Writer
+	jobs          int             // how many iterations of a parallel foreach run at once
+	shellOverride []string        // shell from the command line, wins over the script's settings
+	workerIDs     *atomic.Int64   // hands out worker ids, shared by all forks
+	secrets       *masker         // values replaced with *** in the output, shared by all forks
+	outputMode    OutputMode      // how the output of tasks is shown
+	cache         *localCache     // nil when caching is turned off
+	remoteCache   *remoteCache    // asked when the local cache misses, nil if there is none
+	sandboxAll    bool            // run every task in a sandbox, not only the ones marked with `sandbox`
+	sandbox       *sandbox        // of the running task, nil if it isn't sandboxed
+	deps          *depStore       // dependencies found in depfiles, shared by all forks
+	iterations    *iterationStore // foreach iterations with an output that ran, shared by all forks
 }
 
 func NewInterpreter() *Interpreter {
+	workerIDs := &atomic.Int64{}
+	workerIDs.Store(1) // taken by the main interpreter
+
 	return &Interpreter{
+		ctx:        context.Background(),
 		env:        NewEnvironment(),
 		timestamps: make(map[string]time.Time),
+		stats:      newBuildStats(),
+		worker:     1,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		jobs:       runtime.NumCPU(),
+		workerIDs:  workerIDs,
+		secrets:    &masker{},
+		deps:       newDepStore(),
+		iterations: &iterationStore{done: map[string]string{}},
 	}
 }
 
-func (i *Interpreter) updateTimestamps(inputs []string) error {
+// timestampKey is the key of the timestamp of an input of task. Every task keeps its own, so a task that
+// failed still runs next time when another task with the same inputs succeeded.
+func timestampKey(task, input string) string {
+	return task + "\t" + input
+}
+
+func (i *Interpreter) updateTimestamps(task string, inputs []string) error {
 	for _, input := range inputs {
 		info, err := os.Stat(input)
 		if err != nil {
 			return fmt.Errorf("error updating timestamp for %s: %w", input, err)
 		}
-		i.timestamps[input] = info.ModTime()
+		i.timestamps[timestampKey(task, input)] = info.ModTime()
 	}
 	return nil
 }
@@ -85,6 +150,9 @@ func (i *Interpreter) loadTimestamps(path string) (map[string]time.Time, error)
 
 	timestamps := make(map[string]time.Time)
 	for k, v := range raw {
+		if !strings.Contains(k, "\t") {
+			continue // from before timestamps were kept per task, those tasks run once more
+		}
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
 			return nil, err
@@ -107,6 +175,14 @@ func (i *Interpreter) saveTimestamps(path string, timestamps map[string]time.Tim
 	return os.WriteFile(path, data, 0o644)
 }
 
+// interrupted returns why the build was cancelled (e.g. Ctrl-C), or nil if it wasn't.
+func (i *Interpreter) interrupted() error {
+	if i.ctx.Err() != nil {
+		return context.Cause(i.ctx)
+	}
+	return nil
+}
+
 func (i *Interpreter) GetTasks() map[string]*TaskDef {
 	return i.env.tasks
 }
@@ -143,6 +219,22 @@ func (i *Interpreter) Evaluate(node Node) (any, error) {
 		return i.evaluateShellExpr(node.(*ShellExpr))
 	case ConcatNode:
 		return i.evaluateConcat(node.(*ConcatOperation))
+	case ComparisonNode:
+		return i.evaluateComparison(node.(*ComparisonOperation))
+	case ListNode:
+		return i.evaluateList(node.(*ListLiteral))
+	case CallNode:
+		return i.evaluateCall(node.(*CallExpression))
+	case ArgvNode:
+		return i.evaluateArgv(node.(*ArgvStatement))
+	case DirNode:
+		return i.evaluateDir(node.(*DirStatement))
+	case EnvNode:
+		return i.evaluateEnv(node.(*EnvStatement))
+	case DotenvNode:
+		return i.evaluateDotenv(node.(*DotenvStatement))
+	case SecretNode:
+		return i.evaluateSecret(node.(*SecretStatement))
 	case AssignmentNode:
 		return i.evaluateAssign(node.(*AssignmentStatement))
 	default:
@@ -155,10 +247,31 @@ func (i *Interpreter) evaluateAssign(assignStmt *AssignmentStatement) (any, erro
 	if err != nil {
 		return nil, err
 	}
-	i.env.SetVariable(assignStmt.Name, result)
+	i.assign(assignStmt, result)
 	return result, nil
 }
 
+func (i *Interpreter) evaluateAssignWithoutPrinting(assignStmt *AssignmentStatement) (any, error) {
+	result, err := i.EvaluateWithoutPrinting(assignStmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	i.assign(assignStmt, result)
+	return result, nil
+}
+
+func (i *Interpreter) assign(assignStmt *AssignmentStatement, value any) {
+	switch assignStmt.Scope {
+	case "global":
+		i.env.SetGlobal(assignStmt.Name, value)
+	case "export":
+		i.env.Export(assignStmt.Name, value)
+	default:
+		i.env.SetVariable(assignStmt.Name, value)
+	}
+	i.assigned(assignStmt.Name, value)
+}
+
 func (i *Interpreter) preprocessEvaluateProgram(p *Program) {
 	i.env.progressTotal = 0 // Reset counter
 	i.countExecutableStatements(p)
@@ -183,6 +296,8 @@ func (i *Interpreter) countExecutableStatements(node Node) {
 		i.env.progressTotal++
 	case ShellNode:
 		i.env.progressTotal++
+	case ArgvNode:
+		i.env.progressTotal++
 	case IfNode:
 		ifStmt := node.(*IfStatement)
 		i.countExecutableStatements(ifStmt.ThenBlock)
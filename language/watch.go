@@ -0,0 +1,236 @@
+package language
+
+// this file contains watch mode, which reruns a task every time its inputs change.
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	watchPollInterval = 500 * time.Millisecond // how often inputs are checked without inotify
+	watchDebounce     = 300 * time.Millisecond // inputs have to be left alone this long before a rebuild
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch runs taskName, then runs it again every time an input of the task (or of one of its dependencies)
+// or the script itself changes. The inputs are resolved again after every change, so the input globs pick up
+// new files. It returns the cause of ctx being cancelled.
+func Watch(ctx context.Context, scriptPath string, taskName string, mode EvalMode, opts Options) error {
+	for {
+		content, err := os.ReadFile(scriptPath)
+		if err != nil {
+			return err
+		}
+
+		if err := RunSingleTask(ctx, string(content), taskName, mode, opts); err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			fmt.Printf("\x1b[1;31merror:\x1b[0m %v\n", err)
+		}
+
+		files := watchedFiles(scriptPath, taskName)
+		fmt.Printf("\x1b[1;32m[INFO]\x1b[0m watching %d files for changes to %s (ctrl-c to stop)\n", len(files), taskName)
+
+		if err := waitForChange(ctx, scriptPath, taskName, files); err != nil {
+			return err
+		}
+		fmt.Printf("\x1b[1;32m[INFO]\x1b[0m change detected, rebuilding %s\n", taskName)
+	}
+}
+
+// watchedFiles returns the script and the inputs of taskName and everything it depends on. Outputs of
+// those tasks are left out, so a task whose outputs match its input patterns doesn't trigger itself.
+func watchedFiles(scriptPath string, taskName string) []string {
+	files := []string{scriptPath}
+
+	var inputs []string
+	outputs := map[string]bool{}
+	for _, task := range watchedTasks(scriptPath, taskName) {
+		if found, err := expandInputs(task, false); err == nil {
+			inputs = append(inputs, found...)
+		}
+		if found, err := expandOutputs(task); err == nil {
+			for _, output := range found {
+				outputs[filepath.Clean(output)] = true
+			}
+		}
+	}
+
+	for _, input := range inputs {
+		if !outputs[filepath.Clean(input)] {
+			files = append(files, input)
+		}
+	}
+	return files
+}
+
+// watchedDirs returns the directories new inputs of taskName and everything it depends on can show up in:
+// the directory of the script and the base of every input pattern, with all directories under it for
+// patterns like src/**/*.c. A base that doesn't exist yet is watched through the closest parent that does.
+func watchedDirs(scriptPath string, taskName string) map[string]bool {
+	dirs := map[string]bool{filepath.Dir(scriptPath): true}
+	for _, task := range watchedTasks(scriptPath, taskName) {
+		for _, input := range task.Inputs {
+			for _, pattern := range expandBraces(input) {
+				base, deep := globBase(pattern)
+				dir := base
+				for {
+					if info, err := os.Stat(dir); err == nil && info.IsDir() {
+						break
+					}
+					if parent := filepath.Dir(dir); parent != dir {
+						dir = parent
+						continue
+					}
+					break
+				}
+				dirs[dir] = true
+				if deep && dir == base {
+					addSubdirs(dirs, base)
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+// addSubdirs adds every directory under root to dirs, leaving out .git and the state directory.
+func addSubdirs(dirs map[string]bool, root string) {
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if path != root && (entry.Name() == ".git" || filepath.Clean(path) == STATE_DIR) {
+			return filepath.SkipDir
+		}
+		dirs[path] = true
+		return nil
+	})
+}
+
+// watchedTasks returns taskName and everything it depends on, or nothing while the script doesn't parse.
+func watchedTasks(scriptPath string, taskName string) []*TaskDef {
+	content, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return nil
+	}
+	parser := NewParser(NewLexer(string(content)))
+	program := parser.ParseProgram()
+	if len(parser.errors) > 0 {
+		return nil // only the script until it parses again
+	}
+
+	tasks := map[string]*TaskDef{}
+	for _, stmt := range program.Statements {
+		if task, ok := stmt.(*TaskDef); ok {
+			tasks[task.Name] = task
+		}
+	}
+
+	var visited []*TaskDef
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		task, ok := tasks[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		visited = append(visited, task)
+		for _, dep := range task.Dependencies {
+			visit(dep)
+		}
+	}
+	visit(taskName)
+	return visited
+}
+
+func snapshot(files []string) map[string]fileState {
+	states := make(map[string]fileState, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue // deleted files just drop out of the snapshot
+		}
+		states[file] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return states
+}
+
+// waitForChange blocks until the watched files differ from what they are now and have stopped changing for
+// watchDebounce. Until something changes only the files and the directories from watchedDirs are looked at,
+// a new file changes its directory. After a change the watched files and directories are resolved again, so
+// directories created in the meantime are watched as well.
+func waitForChange(ctx context.Context, scriptPath string, taskName string, files []string) error {
+	last := snapshot(files)
+	for {
+		if err := waitForAny(ctx, files, watchedDirs(scriptPath, taskName)); err != nil {
+			return err
+		}
+
+		settled, err := settle(ctx, scriptPath, taskName)
+		if err != nil {
+			return err
+		}
+		if !maps.Equal(settled, last) {
+			return nil
+		}
+		// something else changed in the directories, like the outputs of the task or a new directory
+	}
+}
+
+// waitForAny blocks until one of files or dirs changes.
+func waitForAny(ctx context.Context, files []string, dirs map[string]bool) error {
+	paths := append(slices.Clone(files), slices.Collect(maps.Keys(dirs))...)
+	last := snapshot(paths)
+
+	notifier := newChangeNotifier(dirs)
+	defer notifier.stop()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-notifier.events():
+		case <-ticker.C:
+		}
+
+		if !maps.Equal(snapshot(paths), last) {
+			return nil
+		}
+	}
+}
+
+// settle waits for a burst of changes (editors saving, formatters, git checkouts) to be over and returns
+// the state of the watched files after it.
+func settle(ctx context.Context, scriptPath string, taskName string) (map[string]fileState, error) {
+	current := snapshot(watchedFiles(scriptPath, taskName))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-time.After(watchDebounce):
+		}
+
+		next := snapshot(watchedFiles(scriptPath, taskName))
+		if maps.Equal(next, current) {
+			return next, nil
+		}
+		current = next
+	}
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package language
+
+import (
+	"os"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// changeNotifier wakes up watch mode when something happens in the watched directories,
+// so changes are seen right away instead of at the next poll.
+type changeNotifier struct {
+	file *os.File
+	ch   chan struct{}
+}
+
+// newChangeNotifier returns nil if inotify can't be used, watch mode then only polls.
+func newChangeNotifier(dirs map[string]bool) *changeNotifier {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil
+	}
+
+	watching := 0
+	for dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err == nil {
+			watching++
+		}
+	}
+	if watching == 0 {
+		syscall.Close(fd)
+		return nil
+	}
+
+	n := &changeNotifier{
+		file: os.NewFile(uintptr(fd), "inotify"),
+		ch:   make(chan struct{}, 1),
+	}
+	go n.read()
+	return n
+}
+
+func (n *changeNotifier) read() {
+	buf := make([]byte, 4096)
+	for {
+		// the events themselves don't matter, the files get compared anyway
+		if _, err := n.file.Read(buf); err != nil {
+			return // closed by stop
+		}
+		select {
+		case n.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *changeNotifier) events() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+	return n.ch
+}
+
+func (n *changeNotifier) stop() {
+	if n != nil {
+		n.file.Close()
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package language
+
+// changeNotifier is only implemented with inotify, everywhere else watch mode polls.
+type changeNotifier struct{}
+
+func newChangeNotifier(dirs map[string]bool) *changeNotifier { return nil }
+
+func (n *changeNotifier) events() <-chan struct{} { return nil }
+
+func (n *changeNotifier) stop() {}
@@ -0,0 +1,81 @@
+package language
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchedFilesLeaveOutOutputs(t *testing.T) {
+	inTempDir(t)
+	writeFile(t, "src/a.txt", "a")
+	writeFile(t, "src/b.txt", "b")
+	writeFile(t, "src/gen.txt", "generated")
+	writeFile(t, "lib/c.txt", "c")
+	writeFile(t, "build.volt", `
+task lib input "lib/*.txt" {
+    shell "true"
+}
+task gen requires lib input "src/*.txt" output "src/gen.txt" {
+    shell "true"
+}
+`)
+
+	got := watchedFiles("build.volt", "gen")
+	slices.Sort(got)
+	want := []string{"build.volt", "lib/c.txt", "src/a.txt", "src/b.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWaitForChangeSeesNewFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		before []string // files there before watching
+		mkdir  string   // created before the file, given time to settle in between
+		create string
+	}{
+		{"new subdirectory", "src/**/*.c", []string{"src/a/x.c"}, "src/b", "src/b/y.c"},
+		{"nested new subdirectory", "src/**/*.c", []string{"src/a/x.c"}, "src/b/c", "src/b/c/y.c"},
+		{"no matches yet", "src/**/*.c", nil, "", "src/y.c"},
+		{"base does not exist yet", "gen/*.c", nil, "gen", "gen/y.c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			for _, file := range tt.before {
+				writeFile(t, file, "x")
+			}
+			writeFile(t, "build.volt", `
+task t input "`+tt.input+`" {
+    shell "true"
+}
+`)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- waitForChange(ctx, "build.volt", "t", watchedFiles("build.volt", "t"))
+			}()
+
+			time.Sleep(watchPollInterval)
+			if tt.mkdir != "" {
+				if err := os.MkdirAll(tt.mkdir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(2 * (watchPollInterval + watchDebounce))
+			}
+			writeFile(t, tt.create, "y")
+
+			if err := <-done; err != nil {
+				t.Fatalf("the new file %s was not noticed: %v", tt.create, err)
+			}
+		})
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/fang"
 	"github.com/spf13/cobra"
@@ -18,10 +22,50 @@ func main() {
 		silent     bool
 		verbose    bool
 		singleTask string
+		tracePath  string
+		keepGoing  bool
+		timeout    time.Duration
+		jobs       int
+		shell      string
+		envFiles   []string
+		output     string
+		noCache    bool
+		cacheSize  string
+		remote     string
+		remoteRO   bool
+		sandbox    bool
 	)
 
+	runOptions := func() l.Options {
+		outputMode, err := l.ParseOutputMode(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+			os.Exit(69)
+		}
+		maxCacheSize, err := l.ParseSize(cacheSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+			os.Exit(69)
+		}
+		return l.Options{
+			TracePath: tracePath,
+			KeepGoing: keepGoing,
+			Timeout:   timeout,
+			Jobs:      jobs,
+			Shell:     strings.Fields(shell),
+			EnvFiles:  envFiles,
+			Output:    outputMode,
+			NoCache:   noCache,
+			CacheSize: maxCacheSize,
+			Sandbox:   sandbox,
+
+			RemoteCache:         remote,
+			RemoteCacheReadOnly: remoteRO,
+		}
+	}
+
 	cmd := &cobra.Command{
-		Use:     "volt-build [optional_path] [-s|--silent] [-v|--verbose] [-V|--version] [-t|--task <task>]",
+		Use:     "volt-build [optional_path] [-s|--silent] [-v|--verbose] [-V|--version] [-t|--task <task>] [-k|--keep-going] [-j|--jobs <n>] [--shell <cmd>] [--env-file <file>] [--output prefix|group|plain] [--no-cache] [--cache-size <size>] [--remote-cache <url> [--remote-cache-read-only]] [--sandbox] [--timeout <duration>] [--trace <file>]",
 		Short:   "A small build system focused on simplicity and speed.",
 		Version: "0.1.1",
 		Args:    cobra.MaximumNArgs(1),
@@ -33,31 +77,27 @@ Supports incremental rebuilds. More features coming soon!`,
 				os.Exit(69)
 			}
 
-			// Default to ./build.volt if no path provided
-			path := "./build.volt"
-			if len(args) == 1 {
-				path = args[0] + "/build.volt"
-			}
-
-			content, err := os.ReadFile(path)
+			content, err := os.ReadFile(scriptPath(args))
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n try -h for help \n", err)
 				os.Exit(1)
 			}
 
 			mode := getMode(silent, verbose)
+			opts := runOptions()
 
+			ctx := cmd.Context()
 			if singleTask != "" {
 				// Run just one task from the build file
-				if err := l.RunSingleTask(string(content), singleTask, mode); err != nil {
+				if err := l.RunSingleTask(ctx, string(content), singleTask, mode, opts); err != nil {
 					fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
-					os.Exit(69)
+					os.Exit(exitCode(ctx, 69))
 				}
 			} else {
 				// Run the entire script
-				if err := l.RunTaskScript(string(content), mode); err != nil {
+				if err := l.RunTaskScript(ctx, string(content), mode, opts); err != nil {
 					fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
-					os.Exit(1)
+					os.Exit(exitCode(ctx, 1))
 				}
 			}
 		},
@@ -65,17 +105,159 @@ Supports incremental rebuilds. More features coming soon!`,
 
 	cmd.CompletionOptions.DisableDefaultCmd = true
 
-	// CLI flags
-	cmd.Flags().StringVarP(&singleTask, "task", "t", "", "Run a single task from the build file")
-	cmd.Flags().BoolVarP(&silent, "silent", "s", false, "Silent evaluation (no output)")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose evaluation (detailed output)")
+	var runs int
+	statsCmd := &cobra.Command{
+		Use:   "stats [-n|--runs <count>]",
+		Short: "Show timings of previous builds",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := l.PrintStats(runs); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	statsCmd.Flags().IntVarP(&runs, "runs", "n", 10, "Number of recent builds to show (0 for all)")
+	cmd.AddCommand(statsCmd)
+
+	logsCmd := &cobra.Command{
+		Use:   "logs [task]",
+		Short: "Show the output of the last run of a task, or list the task logs",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			task := ""
+			if len(args) == 1 {
+				task = args[0]
+			}
+			if err := l.PrintTaskLog(task); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.AddCommand(logsCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect or prune the cache of task outputs",
+	}
+	var maxSize string
+	sizeFlag := func() int64 {
+		size, err := l.ParseSize(maxSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+			os.Exit(69)
+		}
+		return size
+	}
+	cacheStatsCmd := &cobra.Command{
+		Use:   "stats [--max-size <size>]",
+		Short: "Show what's in the cache and how often it was used",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := l.PrintCacheStats(sizeFlag()); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cachePruneCmd := &cobra.Command{
+		Use:   "prune [--max-size <size>]",
+		Short: "Remove the entries used longest ago until the cache fits in max-size (0 empties it)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := l.PruneCache(sizeFlag()); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	for _, c := range []*cobra.Command{cacheStatsCmd, cachePruneCmd} {
+		c.Flags().StringVar(&maxSize, "max-size", "2GB", "Size the cache may take")
+	}
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd)
+	cmd.AddCommand(cacheCmd)
+
+	var dependents, dryRun bool
+	var projectDir string
+	cleanCmd := &cobra.Command{
+		Use:   "clean [task...] [-C|--dir <dir>] [--dependents] [--dry-run]",
+		Short: "Remove the outputs of tasks and forget that they ran (all tasks if none are given)",
+		Run: func(cmd *cobra.Command, args []string) {
+			// outputs and .volt-build are relative to the project, so clean runs in it
+			if projectDir != "" {
+				if err := os.Chdir(projectDir); err != nil {
+					fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := l.Clean(scriptPath(nil), args, dependents, dryRun); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cleanCmd.Flags().StringVarP(&projectDir, "dir", "C", "", "Clean the project in this directory instead of the current one")
+	cleanCmd.Flags().BoolVar(&dependents, "dependents", false, "Also clean the tasks that require the given ones")
+	cleanCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Only print what would be removed")
+	cmd.AddCommand(cleanCmd)
+
+	watchCmd := &cobra.Command{
+		Use:   "watch [optional_path] -t <task>",
+		Short: "Run a task again every time its inputs change",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if singleTask == "" {
+				fmt.Fprintln(os.Stderr, "\x1b[1;31merror:\x1b[0m watch needs a task, pass one with -t")
+				os.Exit(69)
+			}
+			if silent && verbose {
+				fmt.Fprintln(os.Stderr, "\x1b[1;31merror:\x1b[0m cannot mix silent and verbose flags")
+				os.Exit(69)
+			}
+
+			ctx := cmd.Context()
+			if err := l.Watch(ctx, scriptPath(args), singleTask, getMode(silent, verbose), runOptions()); err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[1;31merror:\x1b[0m %v\n", err)
+				os.Exit(exitCode(ctx, 1))
+			}
+		},
+	}
+	cmd.AddCommand(watchCmd)
+
+	// CLI flags, shared by the main command and watch
+	for _, c := range []*cobra.Command{cmd, watchCmd} {
+		c.Flags().StringVarP(&singleTask, "task", "t", "", "Run a single task from the build file")
+		c.Flags().BoolVarP(&silent, "silent", "s", false, "Silent evaluation (no output)")
+		c.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose evaluation (detailed output)")
+		c.Flags().BoolVarP(&keepGoing, "keep-going", "k", false, "Keep running tasks that don't depend on a failed task")
+		c.Flags().IntVarP(&jobs, "jobs", "j", 0, "Iterations of a parallel foreach to run at once (default: number of CPUs)")
+		c.Flags().StringVar(&shell, "shell", "", "Shell for all commands, the command is appended (e.g. \"bash -euo pipefail -c\")")
+		c.Flags().StringArrayVar(&envFiles, "env-file", nil, "Load environment variables from a .env file (can be repeated)")
+		c.Flags().StringVar(&output, "output", "prefix", "How task output is shown: prefix (lines start with [task]), group (all at once when the task is done) or plain")
+		c.Flags().BoolVar(&noCache, "no-cache", false, "Run tasks with outputs instead of restoring them from the cache")
+		c.Flags().StringVar(&cacheSize, "cache-size", "2GB", "Size the cache may grow to before the oldest entries are pruned")
+		c.Flags().StringVar(&remote, "remote-cache", os.Getenv("VOLT_REMOTE_CACHE"), "URL of an HTTP cache (bazel-remote layout) shared with other machines, defaults to $VOLT_REMOTE_CACHE")
+		c.Flags().BoolVar(&remoteRO, "remote-cache-read-only", false, "Only download from the remote cache, never upload to it")
+		c.Flags().BoolVar(&sandbox, "sandbox", false, "Run every task in a directory with only its declared inputs, to find undeclared ones")
+		c.Flags().DurationVar(&timeout, "timeout", 0, "Kill any command running longer than this (e.g. 10m)")
+		c.Flags().StringVar(&tracePath, "trace", "", "Write a Chrome trace (about:tracing/Perfetto) of the build to a file")
+	}
 
 	// Execute the command using fang
-	if err := fang.Execute(context.Background(), cmd); err != nil {
+	if err := fang.Execute(interruptContext(), cmd); err != nil {
 		os.Exit(1)
 	}
 }
 
+// Default to ./build.volt if no path provided
+func scriptPath(args []string) string {
+	if len(args) == 1 {
+		return args[0] + "/build.volt"
+	}
+	return "./build.volt"
+}
+
 // Select evaluation mode based on flags
 func getMode(silent, verbose bool) l.EvalMode {
 	switch {
@@ -87,3 +269,26 @@ func getMode(silent, verbose bool) l.EvalMode {
 		return l.EvalRegular
 	}
 }
+
+// interruptContext is cancelled on the first SIGINT/SIGTERM, which stops the running commands
+// and lets the state of finished tasks get saved. A second signal kills volt-build right away.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		cancel(fmt.Errorf("interrupted by %v", sig))
+	}()
+	return ctx
+}
+
+// exit with 130 like shells do when interrupted, otherwise with code
+func exitCode(ctx context.Context, code int) int {
+	if ctx.Err() != nil {
+		return 130
+	}
+	return code
+}